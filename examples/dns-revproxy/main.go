@@ -5,9 +5,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/hanapedia/maglseven/pkg/balancer"
 	"github.com/hanapedia/maglseven/pkg/dispatcher"
+	"github.com/hanapedia/maglseven/pkg/health"
 	"github.com/hanapedia/maglseven/pkg/maglev"
 	"github.com/hanapedia/maglseven/pkg/proxy"
 	"github.com/hanapedia/maglseven/pkg/watcher"
@@ -23,51 +26,123 @@ func getenv(key, def string) string {
 func main() {
 	fqdn := getenv("BACKEND_FQDN", "hello-headless.default.svc.cluster.local")
 	intervalStr := getenv("RESOLVE_INTERVAL", "10s")
+	ipFamily := getenv("IP_FAMILY", "prefer-ipv4") // prefer-ipv4, prefer-ipv6, ipv4, ipv6 or any
+	// DISCOVERY is a dns://, srv://, k8s://, static:// or file:// spec
+	discovery := getenv("DISCOVERY", "dns://"+fqdn+"?interval="+intervalStr+"&family="+ipFamily)
 	listenPort := getenv("LISTEN_PORT", "8080")
 	destPort := getenv("DEST_PORT", "8080")
 	headerName := getenv("ROUTE_HEADER", "X-Room-ID")
+	algorithm := getenv("BALANCER", balancer.Maglev)
+	outlierErrorsStr := getenv("OUTLIER_CONSECUTIVE_ERRORS", "") // empty to disable
+	maxIdleConnsStr := getenv("MAX_IDLE_CONNS_PER_HOST", "100")
+	idleConnTimeoutStr := getenv("IDLE_CONN_TIMEOUT", "90s")
 
-	interval, err := time.ParseDuration(intervalStr)
+	maxIdleConns, err := strconv.Atoi(maxIdleConnsStr)
+	if err != nil || maxIdleConns < 0 {
+		log.Fatalf("Invalid MAX_IDLE_CONNS_PER_HOST value: %v", err)
+	}
+
+	idleConnTimeout, err := time.ParseDuration(idleConnTimeoutStr)
 	if err != nil {
-		log.Fatalf("Invalid RESOLVE_INTERVAL: %v", err)
+		log.Fatalf("Invalid IDLE_CONN_TIMEOUT: %v", err)
 	}
 
-	log.Printf("Starting Maglev Proxy: resolving %s every %s on :%s using header %s",
-		fqdn, interval, listenPort, headerName)
+	var outlierErrors int
+	if outlierErrorsStr != "" {
+		outlierErrors, err = strconv.Atoi(outlierErrorsStr)
+		if err != nil || outlierErrors <= 0 {
+			log.Fatalf("Invalid OUTLIER_CONSECUTIVE_ERRORS value: %v", err)
+		}
+	}
 
-	watcher := &watcher.DNSWatcher{
-		FQDN:     fqdn,
-		Interval: interval,
+	w, err := watcher.New(discovery)
+	if err != nil {
+		log.Fatalf("Invalid DISCOVERY spec: %v", err)
 	}
+	if dw, ok := w.(*watcher.DNSWatcher); ok {
+		dw.OnError = func(err error) {
+			stats := dw.Stats()
+			log.Printf("DNS resolution failed (%d of %d lookups): %v", stats.Failures, stats.Lookups, err)
+		}
+	}
+
+	log.Printf("Starting Maglev Proxy: discovering backends via %s on :%s using header %s",
+		discovery, listenPort, headerName)
 
 	updates := make(chan []maglev.Backend, 1)
 	ctx := context.Background()
 
 	go func() {
-		if err := watcher.Watch(ctx, updates); err != nil {
+		if err := w.Watch(ctx, updates); err != nil {
 			log.Fatalf("Watcher failed: %v", err)
 		}
 	}()
 
 	var dispatcherInstance *dispatcher.Dispatcher
 
-	// Blocking wait for first backend list
+	build := func(backends []maglev.Backend) (maglev.Balancer, error) {
+		if algorithm != balancer.Maglev {
+			return balancer.New(algorithm, backends)
+		}
+		table, err := maglev.Build(backends, maglev.DefaultTableSize)
+		if err != nil {
+			return nil, err
+		}
+		return table, nil
+	}
+
+	// Blocking wait for the first non-empty backend list
 	initial := <-updates
-	table, _ := maglev.Build(initial, maglev.DefaultTableSize)
+	for len(initial) == 0 {
+		log.Printf("Waiting for backends")
+		initial = <-updates
+	}
+	table, err := build(initial)
+	if err != nil {
+		log.Fatalf("Failed to build %s table: %v", algorithm, err)
+	}
 	dispatcherInstance = dispatcher.NewDispatcher(table, func(r *http.Request) string {
 		return r.Header.Get(headerName)
 	})
 
+	// Passive ejection of backends failing proxied requests
+	var outliers *health.OutlierDetector
+	if outlierErrors > 0 {
+		outliers = health.NewOutlierDetector(health.OutlierConfig{ConsecutiveErrors: outlierErrors}, dispatcherInstance)
+		outliers.SetBackends(initial)
+	}
+
+	handler := proxy.NewProxy(destPort, dispatcherInstance)
+	handler.SetPool(proxy.NewPool(destPort, proxy.TransportConfig{
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     idleConnTimeout,
+	}))
+	handler.SetOutlierDetector(outliers)
+	if err := handler.Pool().SetBackends(initial); err != nil {
+		log.Fatalf("Failed to create backend proxies: %v", err)
+	}
+
 	// Watch for updates
 	go func() {
 		for backends := range updates {
-			newTable, _ := maglev.Build(backends, maglev.DefaultTableSize)
+			if len(backends) == 0 {
+				// e.g., NXDOMAIN with clear-on-nxdomain; no table can be empty
+				log.Printf("No backends left; keeping the last %s table", algorithm)
+				continue
+			}
+			newTable, err := build(backends)
+			if err != nil {
+				log.Printf("Failed to build %s table: %v", algorithm, err)
+				continue
+			}
 			dispatcherInstance.UpdateTable(newTable)
+			outliers.SetBackends(backends)
+			if err := handler.Pool().SetBackends(backends); err != nil {
+				log.Printf("Failed to create backend proxies: %v", err)
+			}
 			log.Printf("Updated Maglev table with %d backends", len(backends))
 		}
 	}()
 
-	handler := proxy.NewProxy(destPort, dispatcherInstance)
-
 	log.Fatal(http.ListenAndServe(":"+listenPort, handler))
 }
@@ -8,9 +8,10 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/hanapedia/maglseven/pkg/balancer"
+	"github.com/hanapedia/maglseven/pkg/health"
 	"github.com/hanapedia/maglseven/pkg/maglev"
 	"github.com/hanapedia/maglseven/pkg/proxy"
-	"github.com/hanapedia/maglseven/pkg/util"
 	"github.com/hanapedia/maglseven/pkg/watcher"
 )
 
@@ -27,15 +28,24 @@ func main() {
 	listenPort := getenv("LISTEN_PORT", "8080")
 	destPort := getenv("DEST_PORT", "8080")
 	headerName := getenv("ROUTE_HEADER", "X-Room-ID")
+	algorithm := getenv("BALANCER", balancer.Maglev)
 	maxHistoryStr := getenv("MAX_HISTORY", "5")
 	replicaCountStr := getenv("REPLICA_COUNT", "3")
 	maxJumpsStr := getenv("MAX_JUMPS", "5")
 	failureCIDRStr := getenv("FAILURE_CIDR", "32")
-
-	interval, err := time.ParseDuration(intervalStr)
-	if err != nil {
-		log.Fatalf("Invalid RESOLVE_INTERVAL: %v", err)
-	}
+	failureCIDR6Str := getenv("FAILURE_CIDR6", "128")
+	ipFamily := getenv("IP_FAMILY", "prefer-ipv4") // prefer-ipv4, prefer-ipv6, ipv4, ipv6 or any
+	// DISCOVERY is a dns://, srv://, k8s://, static:// or file:// spec
+	discovery := getenv("DISCOVERY", "dns://"+fqdn+"?interval="+intervalStr+"&cidr="+failureCIDRStr+"&cidr6="+failureCIDR6Str+"&family="+ipFamily)
+	boundedLoadStr := getenv("BOUNDED_LOAD_EPSILON", "")
+	guaranteeStr := getenv("GUARANTEE_REPLICAS", "false")
+	healthCheck := getenv("HEALTH_CHECK", "") // "tcp", "http" or empty to disable
+	healthCheckPath := getenv("HEALTH_CHECK_PATH", "/healthz")
+	outlierErrorsStr := getenv("OUTLIER_CONSECUTIVE_ERRORS", "") // empty to disable
+	maxIdleConnsStr := getenv("MAX_IDLE_CONNS_PER_HOST", "100")
+	idleConnTimeoutStr := getenv("IDLE_CONN_TIMEOUT", "90s")
+	maxRetriesStr := getenv("MAX_RETRIES", "0") // failover attempts on replication peers
+	retryMaxBodyStr := getenv("RETRY_MAX_BODY_BYTES", "65536")
 
 	maxHistory, err := strconv.Atoi(maxHistoryStr)
 	if err != nil || maxHistory <= 0 {
@@ -52,20 +62,62 @@ func main() {
 		log.Fatalf("Invalid MAX_JUMPS value: %v", err)
 	}
 
-	failureCIDR, err := util.ParseCIDRMaskFromString(failureCIDRStr)
+	guaranteeReplicas, err := strconv.ParseBool(guaranteeStr)
+	if err != nil {
+		log.Fatalf("Invalid GUARANTEE_REPLICAS value: %v", err)
+	}
+
+	maxIdleConns, err := strconv.Atoi(maxIdleConnsStr)
+	if err != nil || maxIdleConns < 0 {
+		log.Fatalf("Invalid MAX_IDLE_CONNS_PER_HOST value: %v", err)
+	}
+
+	idleConnTimeout, err := time.ParseDuration(idleConnTimeoutStr)
 	if err != nil {
-		log.Fatalf("Invalid FAILURE_CIDR value: %v", err)
+		log.Fatalf("Invalid IDLE_CONN_TIMEOUT: %v", err)
+	}
+
+	maxRetries, err := strconv.Atoi(maxRetriesStr)
+	if err != nil || maxRetries < 0 {
+		log.Fatalf("Invalid MAX_RETRIES value: %v", err)
 	}
 
-	log.Printf("Starting Handoff Proxy: resolving %s every %s on :%s using header %s",
-		fqdn, interval, listenPort, headerName)
+	retryMaxBody, err := strconv.ParseInt(retryMaxBodyStr, 10, 64)
+	if err != nil || retryMaxBody < 0 {
+		log.Fatalf("Invalid RETRY_MAX_BODY_BYTES value: %v", err)
+	}
+
+	var outlierErrors int
+	if outlierErrorsStr != "" {
+		outlierErrors, err = strconv.Atoi(outlierErrorsStr)
+		if err != nil || outlierErrors <= 0 {
+			log.Fatalf("Invalid OUTLIER_CONSECUTIVE_ERRORS value: %v", err)
+		}
+	}
+
+	var loads *maglev.LoadTracker
+	if boundedLoadStr != "" {
+		epsilon, err := strconv.ParseFloat(boundedLoadStr, 64)
+		if err != nil || epsilon < 0 {
+			log.Fatalf("Invalid BOUNDED_LOAD_EPSILON value: %v", err)
+		}
+		loads = maglev.NewLoadTracker(epsilon)
+	}
 
-	w := &watcher.DNSWatcher{
-		FQDN:        fqdn,
-		Interval:    interval,
-		FailureCIDR: &failureCIDR,
+	w, err := watcher.New(discovery)
+	if err != nil {
+		log.Fatalf("Invalid DISCOVERY spec: %v", err)
+	}
+	if dw, ok := w.(*watcher.DNSWatcher); ok {
+		dw.OnError = func(err error) {
+			stats := dw.Stats()
+			log.Printf("DNS resolution failed (%d of %d lookups): %v", stats.Failures, stats.Lookups, err)
+		}
 	}
 
+	log.Printf("Starting Handoff Proxy: discovering backends via %s on :%s using header %s",
+		discovery, listenPort, headerName)
+
 	updates := make(chan []maglev.Backend, 1)
 	ctx := context.Background()
 
@@ -75,12 +127,72 @@ func main() {
 		}
 	}()
 
-	// First maglev table
+	build := func(backends []maglev.Backend) (maglev.Balancer, error) {
+		if algorithm != balancer.Maglev {
+			return balancer.New(algorithm, backends)
+		}
+		table, err := maglev.Build(backends, maglev.DefaultTableSize)
+		if err != nil {
+			return nil, err
+		}
+		return table, nil
+	}
+
+	// First maglev table, once there are backends
 	initial := <-updates
-	table, _ := maglev.Build(initial, maglev.DefaultTableSize)
+	for len(initial) == 0 {
+		log.Printf("Waiting for backends")
+		initial = <-updates
+	}
+	table, err := build(initial)
+	if err != nil {
+		log.Fatalf("Failed to build %s table: %v", algorithm, err)
+	}
 	// Initialize VersionedRouter
 	versionedRouter := maglev.NewVersionedRouter(maxHistory)
 	versionedRouter.AddGeneration(1, table)
+	versionedRouter.SetLoadTracker(loads)
+	versionedRouter.SetGuaranteeReplicas(guaranteeReplicas)
+
+	var checker *health.Checker
+	if healthCheck != "" {
+		cfg := health.Config{Type: health.ProbeTCP, Port: destPort, Path: healthCheckPath}
+		if healthCheck == "http" {
+			cfg.Type = health.ProbeHTTP
+		}
+		checker, err = health.NewChecker(cfg)
+		if err != nil {
+			log.Fatalf("Invalid health check config: %v", err)
+		}
+		checker.SetBackends(initial)
+
+		transitions := make(chan health.Transition)
+		go func() {
+			if err := checker.Run(ctx, transitions); err != nil {
+				log.Printf("Health checker stopped: %v", err)
+			}
+		}()
+		go health.Apply(ctx, transitions, versionedRouter)
+	}
+
+	// Passive ejection of backends failing proxied requests
+	var outliers *health.OutlierDetector
+	if outlierErrors > 0 {
+		outliers = health.NewOutlierDetector(health.OutlierConfig{ConsecutiveErrors: outlierErrors}, versionedRouter)
+		outliers.SetBackends(initial)
+	}
+
+	// Use new versioned proxy
+	handler := proxy.NewHandoffProxy(destPort, versionedRouter, replicaCount, maxJumps)
+	handler.SetPool(proxy.NewPool(destPort, proxy.TransportConfig{
+		MaxIdleConnsPerHost: maxIdleConns,
+		IdleConnTimeout:     idleConnTimeout,
+	}))
+	handler.SetOutlierDetector(outliers)
+	handler.SetRetryPolicy(proxy.RetryPolicy{MaxRetries: maxRetries, MaxBodyBytes: retryMaxBody})
+	if err := handler.Pool().SetBackends(initial); err != nil {
+		log.Fatalf("Failed to create backend proxies: %v", err)
+	}
 
 	// Track current generation count
 	var genCounter uint64 = 1
@@ -88,15 +200,31 @@ func main() {
 	// Watch updates and rotate generations
 	go func() {
 		for backends := range updates {
+			if len(backends) == 0 {
+				// e.g., NXDOMAIN with clear-on-nxdomain; no table can be empty
+				log.Printf("No backends left; keeping generation %d", genCounter)
+				continue
+			}
+			newTable, err := build(backends)
+			if err != nil {
+				log.Printf("Failed to build %s table: %v", algorithm, err)
+				continue
+			}
 			genCounter++
-			newTable, _ := maglev.Build(backends, maglev.DefaultTableSize)
-			versionedRouter.AddGeneration(genCounter, newTable)
+			if checker != nil {
+				checker.SetBackends(backends)
+			}
+			outliers.SetBackends(backends)
+			if err := handler.Pool().SetBackends(backends); err != nil {
+				log.Printf("Failed to create backend proxies: %v", err)
+			}
+			report := versionedRouter.AddGeneration(genCounter, newTable)
 			log.Printf("Updated maglev table to generation %d with %d backends", genCounter, len(backends))
+			if report != nil {
+				log.Printf("Generation %d reassigned %.2f%% of slots", genCounter, report.MovedFraction*100)
+			}
 		}
 	}()
 
-	// Use new versioned proxy
-	handler := proxy.NewHandoffProxy(destPort, versionedRouter, replicaCount, maxJumps)
-
 	log.Fatal(http.ListenAndServe(":"+listenPort, handler))
 }
@@ -5,7 +5,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"time"
 
 	"github.com/hanapedia/maglseven/pkg/dispatcher"
 	"github.com/hanapedia/maglseven/pkg/maglev"
@@ -21,39 +20,44 @@ func getenv(key, def string) string {
 }
 
 func main() {
-	fqdn := getenv("BACKEND_FQDN", "hello-headless.default.svc.cluster.local")
-	intervalStr := getenv("RESOLVE_INTERVAL", "10s")
+	namespace := getenv("BACKEND_NAMESPACE", "default")
+	service := getenv("BACKEND_SERVICE", "hello-headless")
+	// DISCOVERY is a dns://, srv://, k8s://, static:// or file:// spec
+	discovery := getenv("DISCOVERY", "k8s://"+namespace+"/"+service)
 	listenPort := getenv("LISTEN_PORT", "8080")
 	destPort := getenv("DEST_PORT", "8080")
 	headerName := getenv("ROUTE_HEADER", "X-Room-ID")
 
-	interval, err := time.ParseDuration(intervalStr)
+	w, err := watcher.New(discovery)
 	if err != nil {
-		log.Fatalf("Invalid RESOLVE_INTERVAL: %v", err)
+		log.Fatalf("Invalid DISCOVERY spec: %v", err)
 	}
 
-	log.Printf("Starting Maglev Proxy: resolving %s every %s on :%s using header %s",
-		fqdn, interval, listenPort, headerName)
-
-	watcher := &watcher.EndpointSlicesWatcher{
-		Namespace: "default",
-		Service:   "hello-headless",
-	}
+	log.Printf("Starting Maglev Proxy: discovering backends via %s on :%s using header %s",
+		discovery, listenPort, headerName)
 
 	updates := make(chan []maglev.Backend, 1)
 	ctx := context.Background()
 
 	go func() {
-		if err := watcher.Watch(ctx, updates); err != nil {
+		if err := w.Watch(ctx, updates); err != nil {
 			log.Fatalf("watcher failed: %v", err)
 		}
 	}()
 
 	var dispatcherInstance *dispatcher.Dispatcher
 
-	// Blocking wait for first backend list
+	// Blocking wait for the first non-empty backend list; a Service
+	// may have no ready endpoints yet
 	initial := <-updates
-	table, _ := maglev.Build(initial, maglev.DefaultTableSize)
+	for len(initial) == 0 {
+		log.Printf("Waiting for backends")
+		initial = <-updates
+	}
+	table, err := maglev.Build(initial, maglev.DefaultTableSize)
+	if err != nil {
+		log.Fatalf("Failed to build maglev table: %v", err)
+	}
 	dispatcherInstance = dispatcher.NewDispatcher(table, func(r *http.Request) string {
 		return r.Header.Get(headerName)
 	})
@@ -61,7 +65,16 @@ func main() {
 	// Watch for updates
 	go func() {
 		for backends := range updates {
-			newTable, _ := maglev.Build(backends, maglev.DefaultTableSize)
+			if len(backends) == 0 {
+				// e.g., all endpoints are gone; no table can be empty
+				log.Printf("No backends left; keeping the last maglev table")
+				continue
+			}
+			newTable, err := maglev.Build(backends, maglev.DefaultTableSize)
+			if err != nil {
+				log.Printf("Failed to build maglev table: %v", err)
+				continue
+			}
 			dispatcherInstance.UpdateTable(newTable)
 			log.Printf("Updated Maglev table with %d backends", len(backends))
 		}
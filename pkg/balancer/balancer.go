@@ -0,0 +1,167 @@
+package balancer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// Algorithm names accepted by New
+const (
+	Maglev     = "maglev"
+	Rendezvous = "rendezvous"
+	Jump       = "jump"
+	Ring       = "ring"
+)
+
+// New builds a balancer of the named algorithm over backends
+func New(algorithm string, backends []maglev.Backend) (maglev.Balancer, error) {
+	switch algorithm {
+	case Maglev:
+		return asBalancer(maglev.Build(backends, maglev.DefaultTableSize))
+	case Rendezvous:
+		return asBalancer(NewRendezvous(backends))
+	case Jump:
+		return asBalancer(NewJump(backends))
+	case Ring:
+		return asBalancer(NewRing(backends, DefaultRingPoints))
+	default:
+		return nil, fmt.Errorf("unknown balancing algorithm: %q", algorithm)
+	}
+}
+
+// asBalancer avoids wrapping a nil pointer in a non-nil interface
+func asBalancer[B maglev.Balancer](b B, err error) (maglev.Balancer, error) {
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// preference yields backend indices for a key, most preferred first,
+// each index at most once
+type preference func(key string) iter.Seq[int]
+
+// backendSet holds the canonical backend list shared by all algorithms
+type backendSet struct {
+	backends []maglev.Backend
+}
+
+func newBackendSet(backends []maglev.Backend) (backendSet, error) {
+	if len(backends) == 0 {
+		return backendSet{}, errors.New("invalid inputs")
+	}
+
+	// Sort so that equal backend sets map keys identically
+	sorted := slices.Clone(backends)
+	slices.SortFunc(sorted, func(a, b maglev.Backend) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return backendSet{backends: sorted}, nil
+}
+
+func (s backendSet) String() string {
+	ids := make([]string, len(s.backends))
+	for i, b := range s.backends {
+		ids[i] = b.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// lookupN returns the first `n` backends in preference order
+func (s backendSet) lookupN(order preference, key string, n int) []maglev.Backend {
+	if n <= 0 {
+		return nil
+	}
+
+	result := make([]maglev.Backend, 0, min(n, len(s.backends)))
+	for idx := range order(key) {
+		result = append(result, s.backends[idx])
+		if len(result) >= n {
+			break
+		}
+	}
+	return result
+}
+
+// lookupNWithDomainIsolation returns up to `count` backends from
+// distinct failure domains among the first `maxJumps` preferences,
+// passing over those for which a non-nil skip returns true
+func (s backendSet) lookupNWithDomainIsolation(order preference, key string, count, maxJumps int, skip func(maglev.Backend) bool) []maglev.Backend {
+	if count <= 0 || maxJumps <= 0 {
+		return nil
+	}
+
+	result := make([]maglev.Backend, 0, count)
+	seenDomains := make(map[string]struct{}) // domain ID
+	attempts := 0
+	for idx := range order(key) {
+		if len(result) >= count || attempts >= maxJumps {
+			break
+		}
+		attempts++
+
+		backend := s.backends[idx]
+		if skip != nil && skip(backend) {
+			continue
+		}
+		if _, domainSeen := seenDomains[backend.FailureDomain]; domainSeen {
+			continue // same domain already chosen
+		}
+		result = append(result, backend)
+		seenDomains[backend.FailureDomain] = struct{}{}
+	}
+	return result
+}
+
+// weights returns each backend's weight, or all ones if none is positive
+func (s backendSet) weights() []float64 {
+	weights := make([]float64, len(s.backends))
+	var total float64
+	for i, b := range s.backends {
+		weights[i] = float64(b.Weight)
+		total += weights[i]
+	}
+	if total == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+// primaries returns the indices of backends that may be primary and of
+// the zero-weight backends that only serve as trailing peers
+func (s backendSet) primaries() (primary, standby []int) {
+	for i, w := range s.weights() {
+		if w > 0 {
+			primary = append(primary, i)
+		} else {
+			standby = append(standby, i)
+		}
+	}
+	return primary, standby
+}
+
+// rankStandby returns standby backend indices ranked for the key by
+// highest random weight, as Maglev tables rank zero-weight backends
+func (s backendSet) rankStandby(keyHash uint64, standby []int) []int {
+	scores := make(map[int]uint64, len(standby))
+	for _, idx := range standby {
+		scores[idx] = maglev.Mix64(keyHash ^ hashKey(s.backends[idx].ID))
+	}
+	ranked := slices.Clone(standby)
+	slices.SortFunc(ranked, func(a, b int) int {
+		return cmp.Compare(scores[b], scores[a])
+	})
+	return ranked
+}
+
+func hashKey(s string) uint64 {
+	return maglev.HashXXHash64.Sum(s)
+}
@@ -0,0 +1,144 @@
+package balancer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+var algorithms = []string{Maglev, Rendezvous, Jump, Ring}
+
+func TestZeroWeightBackendsArePeerOnly(t *testing.T) {
+	backends := []maglev.Backend{
+		{ID: "10.0.0.1", FailureDomain: "a", Weight: 1},
+		{ID: "10.0.0.2", FailureDomain: "b", Weight: 2},
+		{ID: "10.0.0.3", FailureDomain: "c", Weight: 1},
+		{ID: "10.0.0.4", FailureDomain: "d", Weight: 0},
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			b, err := New(algorithm, backends)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			for i := range 500 {
+				key := fmt.Sprintf("room-%d", i)
+				if got := b.Lookup(key); got.Weight == 0 {
+					t.Fatalf("Lookup(%q) = zero-weight backend %s", key, got.ID)
+				}
+
+				peers := b.LookupN(key, len(backends))
+				if len(peers) != len(backends) {
+					t.Fatalf("LookupN(%q) returned %d backends, want %d", key, len(peers), len(backends))
+				}
+				if peers[0] != b.Lookup(key) {
+					t.Fatalf("LookupN(%q)[0] = %s, want Lookup's %s", key, peers[0].ID, b.Lookup(key).ID)
+				}
+				if last := peers[len(peers)-1]; last.Weight != 0 {
+					t.Fatalf("LookupN(%q) ends with %s, want the zero-weight backend", key, last.ID)
+				}
+
+				isolated := b.LookupNWithDomainIsolation(key, len(backends), len(backends))
+				if len(isolated) == 0 || isolated[0].Weight == 0 {
+					t.Fatalf("LookupNWithDomainIsolation(%q) = %v, want a weighted primary", key, isolated)
+				}
+			}
+		})
+	}
+}
+
+func TestAllZeroWeightsAreEqual(t *testing.T) {
+	backends := []maglev.Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			b, err := New(algorithm, backends)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			counts := make(map[string]int)
+			for i := range 3000 {
+				counts[b.Lookup(fmt.Sprintf("room-%d", i)).ID]++
+			}
+			for _, backend := range backends {
+				if counts[backend.ID] < 700 {
+					t.Errorf("backend %s got %d of 3000 keys, want about a third", backend.ID, counts[backend.ID])
+				}
+			}
+		})
+	}
+}
+
+func TestLookupNGuaranteedRelaxed(t *testing.T) {
+	distinct := make([]maglev.Backend, 10)
+	for i := range distinct {
+		distinct[i] = maglev.Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), FailureDomain: fmt.Sprintf("zone-%d", i), Weight: 1}
+	}
+	shared := []maglev.Backend{
+		{ID: "10.0.0.1", FailureDomain: "zone-a", Weight: 1},
+		{ID: "10.0.0.2", FailureDomain: "zone-a", Weight: 1},
+		{ID: "10.0.0.3", FailureDomain: "zone-b", Weight: 1},
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			b, err := New(algorithm, distinct)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			// Too few jumps to isolate, but the fill still lands in new domains
+			for i := range 100 {
+				key := fmt.Sprintf("room-%d", i)
+				got, relaxed := maglev.LookupNGuaranteed(b, key, 3, 2)
+				if len(got) != 3 || relaxed {
+					t.Fatalf("LookupNGuaranteed(%q) = %d backends, relaxed %v; want 3, false", key, len(got), relaxed)
+				}
+			}
+
+			b, err = New(algorithm, shared)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			got, relaxed := maglev.LookupNGuaranteed(b, "room-1", 3, 10)
+			if len(got) != 3 || !relaxed {
+				t.Fatalf("LookupNGuaranteed = %d backends, relaxed %v; want 3, true", len(got), relaxed)
+			}
+		})
+	}
+}
+
+func TestLookupNWithDomainIsolationSkipping(t *testing.T) {
+	backends := make([]maglev.Backend, 10)
+	for i := range backends {
+		backends[i] = maglev.Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), FailureDomain: fmt.Sprintf("zone-%d", i), Weight: 1}
+	}
+
+	for _, algorithm := range algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			b, err := New(algorithm, backends)
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+			sb, ok := b.(maglev.SkippingBalancer)
+			if !ok {
+				t.Fatalf("%T is not a SkippingBalancer", b)
+			}
+
+			for i := range 100 {
+				key := fmt.Sprintf("room-%d", i)
+				full := b.LookupNWithDomainIsolation(key, 3, 20)
+				skipped := full[1].ID
+				got := sb.LookupNWithDomainIsolationSkipping(key, 3, 20, func(b maglev.Backend) bool {
+					return b.ID == skipped
+				})
+				if len(got) != 3 || got[0] != full[0] || got[1] != full[2] {
+					t.Fatalf("%s: skipping %s gave %v, want %v backfilled", key, skipped, got, full)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package balancer
+
+import (
+	"iter"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// JumpBalancer implements Jump Consistent Hash over backends sorted by
+// ID. It ignores positive weights and only moves a minimal share of
+// keys when backends are added or removed at the end of the sorted
+// order (e.g., StatefulSet ordinals); other changes shift bucket
+// numbers. Zero-weight backends get no bucket and only serve as peers.
+type JumpBalancer struct {
+	backendSet
+	buckets []int // bucket -> backend index
+	standby []int // zero-weight backend indices
+}
+
+// NewJump returns a jump consistent hash balancer over backends
+func NewJump(backends []maglev.Backend) (*JumpBalancer, error) {
+	set, err := newBackendSet(backends)
+	if err != nil {
+		return nil, err
+	}
+	buckets, standby := set.primaries()
+	return &JumpBalancer{backendSet: set, buckets: buckets, standby: standby}, nil
+}
+
+// Lookup returns the backend for a given key
+func (j *JumpBalancer) Lookup(key string) maglev.Backend {
+	return j.backends[j.buckets[jumpHash(hashKey(key), len(j.buckets))]]
+}
+
+// LookupN returns up to `n` unique backends for the given key
+func (j *JumpBalancer) LookupN(key string, n int) []maglev.Backend {
+	return j.lookupN(j.order, key, n)
+}
+
+// LookupNWithDomainIsolation returns up to `count` backends from
+// distinct failure domains among the first `maxJumps` candidates
+func (j *JumpBalancer) LookupNWithDomainIsolation(key string, count, maxJumps int) []maglev.Backend {
+	return j.lookupNWithDomainIsolation(j.order, key, count, maxJumps, nil)
+}
+
+// LookupNWithDomainIsolationSkipping is LookupNWithDomainIsolation with
+// the backends for which skip returns true passed over
+func (j *JumpBalancer) LookupNWithDomainIsolationSkipping(key string, count, maxJumps int, skip func(maglev.Backend) bool) []maglev.Backend {
+	return j.lookupNWithDomainIsolation(j.order, key, count, maxJumps, skip)
+}
+
+// order yields the jump hash of the key re-seeded per attempt, skipping
+// repeats; after 4n attempts the remaining buckets follow in index
+// order, then the zero-weight backends
+func (j *JumpBalancer) order(key string) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		n := len(j.buckets)
+		seen := make([]bool, n)
+		found := 0
+		keyHash := hashKey(key)
+
+		for attempt := uint64(0); found < n && attempt < uint64(4*n); attempt++ {
+			seed := keyHash
+			if attempt > 0 {
+				seed = maglev.Mix64(keyHash + attempt)
+			}
+			idx := jumpHash(seed, n)
+			if seen[idx] {
+				continue
+			}
+			seen[idx] = true
+			found++
+			if !yield(j.buckets[idx]) {
+				return
+			}
+		}
+
+		for idx := range n {
+			if !seen[idx] && !yield(j.buckets[idx]) {
+				return
+			}
+		}
+
+		for _, idx := range j.rankStandby(keyHash, j.standby) {
+			if !yield(idx) {
+				return
+			}
+		}
+	}
+}
+
+// jumpHash is Lamping and Veach's Jump Consistent Hash
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
@@ -0,0 +1,98 @@
+package balancer
+
+import (
+	"iter"
+	"math"
+	"slices"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// RendezvousBalancer implements weighted rendezvous (highest random
+// weight) hashing. Each lookup ranks every backend, so it costs O(n)
+// per key; zero-weight backends rank last and only serve as peers.
+type RendezvousBalancer struct {
+	backendSet
+	weights  []float64
+	idHashes []uint64
+}
+
+// NewRendezvous returns a rendezvous balancer over backends
+func NewRendezvous(backends []maglev.Backend) (*RendezvousBalancer, error) {
+	set, err := newBackendSet(backends)
+	if err != nil {
+		return nil, err
+	}
+
+	idHashes := make([]uint64, len(set.backends))
+	for i, b := range set.backends {
+		idHashes[i] = hashKey(b.ID)
+	}
+	return &RendezvousBalancer{
+		backendSet: set,
+		weights:    set.weights(),
+		idHashes:   idHashes,
+	}, nil
+}
+
+// Lookup returns the backend for a given key
+func (r *RendezvousBalancer) Lookup(key string) maglev.Backend {
+	best, bestScore := 0, math.Inf(-1)
+	keyHash := hashKey(key)
+	for i := range r.backends {
+		if score := r.score(keyHash, i); score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return r.backends[best]
+}
+
+// LookupN returns up to `n` unique backends for the given key
+func (r *RendezvousBalancer) LookupN(key string, n int) []maglev.Backend {
+	return r.lookupN(r.order, key, n)
+}
+
+// LookupNWithDomainIsolation returns up to `count` backends from
+// distinct failure domains among the `maxJumps` highest ranked
+func (r *RendezvousBalancer) LookupNWithDomainIsolation(key string, count, maxJumps int) []maglev.Backend {
+	return r.lookupNWithDomainIsolation(r.order, key, count, maxJumps, nil)
+}
+
+// LookupNWithDomainIsolationSkipping is LookupNWithDomainIsolation with
+// the backends for which skip returns true passed over
+func (r *RendezvousBalancer) LookupNWithDomainIsolationSkipping(key string, count, maxJumps int, skip func(maglev.Backend) bool) []maglev.Backend {
+	return r.lookupNWithDomainIsolation(r.order, key, count, maxJumps, skip)
+}
+
+// order ranks all backends by descending score
+func (r *RendezvousBalancer) order(key string) iter.Seq[int] {
+	keyHash := hashKey(key)
+	scores := make([]float64, len(r.backends))
+	ranked := make([]int, len(r.backends))
+	for i := range r.backends {
+		scores[i] = r.score(keyHash, i)
+		ranked[i] = i
+	}
+	slices.SortStableFunc(ranked, func(a, b int) int {
+		switch {
+		case scores[a] > scores[b]:
+			return -1
+		case scores[a] < scores[b]:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return slices.Values(ranked)
+}
+
+// score is the logarithmic weighted HRW score -w/ln(u), u in (0, 1).
+// Zero-weight backends score ln(u) < 0, below every weighted backend.
+func (r *RendezvousBalancer) score(keyHash uint64, i int) float64 {
+	h := maglev.Mix64(keyHash ^ r.idHashes[i])
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	if r.weights[i] == 0 {
+		return math.Log(u)
+	}
+	return -r.weights[i] / math.Log(u)
+}
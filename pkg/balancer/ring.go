@@ -0,0 +1,123 @@
+package balancer
+
+import (
+	"cmp"
+	"errors"
+	"iter"
+	"math"
+	"slices"
+	"strconv"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// DefaultRingPoints is the ketama default of 160 points per backend
+const DefaultRingPoints = 160
+
+// RingBalancer implements a ketama-style consistent hash ring. Each
+// backend gets points in proportion to its weight; zero-weight backends
+// get none and follow the ring's backends as peers.
+type RingBalancer struct {
+	backendSet
+	points  []ringPoint // sorted by hash
+	standby []int       // indices of backends without points
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend int
+}
+
+// NewRing returns a ring with about pointsPerBackend points per backend of average weight
+func NewRing(backends []maglev.Backend, pointsPerBackend int) (*RingBalancer, error) {
+	set, err := newBackendSet(backends)
+	if err != nil {
+		return nil, err
+	}
+	if pointsPerBackend <= 0 {
+		return nil, errors.New("invalid points per backend")
+	}
+
+	weights := set.weights()
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+
+	var points []ringPoint
+	var standby []int
+	for i, b := range set.backends {
+		n := int(math.Round(float64(pointsPerBackend*len(weights)) * weights[i] / total))
+		if n == 0 {
+			standby = append(standby, i)
+		}
+		for p := range n {
+			points = append(points, ringPoint{hash: hashKey(b.ID + "-" + strconv.Itoa(p)), backend: i})
+		}
+	}
+	if len(points) == 0 {
+		return nil, errors.New("no backend has ring points")
+	}
+	slices.SortFunc(points, func(a, b ringPoint) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), cmp.Compare(a.backend, b.backend))
+	})
+
+	return &RingBalancer{backendSet: set, points: points, standby: standby}, nil
+}
+
+// Lookup returns the backend for a given key
+func (r *RingBalancer) Lookup(key string) maglev.Backend {
+	return r.backends[r.points[r.search(key)].backend]
+}
+
+// LookupN returns up to `n` unique backends for the given key
+func (r *RingBalancer) LookupN(key string, n int) []maglev.Backend {
+	return r.lookupN(r.order, key, n)
+}
+
+// LookupNWithDomainIsolation returns up to `count` backends from
+// distinct failure domains among the first `maxJumps` distinct backends
+// clockwise from the key
+func (r *RingBalancer) LookupNWithDomainIsolation(key string, count, maxJumps int) []maglev.Backend {
+	return r.lookupNWithDomainIsolation(r.order, key, count, maxJumps, nil)
+}
+
+// LookupNWithDomainIsolationSkipping is LookupNWithDomainIsolation with
+// the backends for which skip returns true passed over
+func (r *RingBalancer) LookupNWithDomainIsolationSkipping(key string, count, maxJumps int, skip func(maglev.Backend) bool) []maglev.Backend {
+	return r.lookupNWithDomainIsolation(r.order, key, count, maxJumps, skip)
+}
+
+// search returns the index of the first point at or after the key's hash
+func (r *RingBalancer) search(key string) int {
+	h := hashKey(key)
+	i, _ := slices.BinarySearchFunc(r.points, h, func(p ringPoint, h uint64) int {
+		return cmp.Compare(p.hash, h)
+	})
+	return i % len(r.points)
+}
+
+// order walks the ring clockwise from the key, yielding distinct
+// backends, then the backends without points
+func (r *RingBalancer) order(key string) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		seen := make([]bool, len(r.backends))
+		start := r.search(key)
+		for i := range r.points {
+			idx := r.points[(start+i)%len(r.points)].backend
+			if seen[idx] {
+				continue
+			}
+			seen[idx] = true
+			if !yield(idx) {
+				return
+			}
+		}
+
+		for _, idx := range r.rankStandby(hashKey(key), r.standby) {
+			if !yield(idx) {
+				return
+			}
+		}
+	}
+}
@@ -1,21 +1,27 @@
 package dispatcher
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
 
 	"github.com/hanapedia/maglseven/pkg/maglev"
 	"github.com/hanapedia/maglseven/pkg/util"
 )
 
 type Dispatcher struct {
-	table  *maglev.Table
 	keyFn  func(*http.Request) string
 	logger util.Logger
+
+	mu        sync.RWMutex // guards the fields below
+	table     maglev.Balancer
+	loads     *maglev.LoadTracker // bounded-load mode when non-nil
+	unhealthy maglev.UnhealthySet
 }
 
-// NewDispatcher returns a dispatcher with a given Maglev table and key extraction function
-func NewDispatcher(table *maglev.Table, keyFn func(*http.Request) string) *Dispatcher {
+// NewDispatcher returns a dispatcher with a given balancer (e.g., a Maglev table) and key extraction function
+func NewDispatcher(table maglev.Balancer, keyFn func(*http.Request) string) *Dispatcher {
 	return &Dispatcher{
 		table: table,
 		keyFn: keyFn,
@@ -25,21 +31,68 @@ func NewDispatcher(table *maglev.Table, keyFn func(*http.Request) string) *Dispa
 
 // Route selects a backend URL for an incoming HTTP request
 func (d *Dispatcher) Route(r *http.Request) string {
+	return d.RouteBackend(r).ID
+}
+
+// RouteBackend selects a backend, with its address, for an incoming HTTP request
+func (d *Dispatcher) RouteBackend(r *http.Request) maglev.Backend {
 	key := d.keyFn(r)
-	id := d.table.Lookup(key).ID
-	d.logger.Debug("Routing request", "key", key, "ID", id) // Debug log for "key -> ID" mapping
-	return id
+	backend := d.lookup(key)
+	d.logger.Debug("Routing request", "key", key, "ID", backend.ID) // Debug log for "key -> ID" mapping
+	return backend
 }
 
 // RouteByKey selects a backend URL for an incoming key
 func (d *Dispatcher) RouteByKey(key string) string {
-	id := d.table.Lookup(key).ID
+	id := d.lookup(key).ID
 	d.logger.Debug("Routing request", "key", key, "ID", id) // Debug log for "key -> ID" mapping
 	return id
 }
 
-func (d *Dispatcher) UpdateTable(t *maglev.Table) {
+// lookup returns the backend for key, falling back to the next healthy
+// backend in the table's preference order if it is unhealthy
+func (d *Dispatcher) lookup(key string) maglev.Backend {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	backend := maglev.LookupBounded(d.table, key, d.loads)
+	if !d.unhealthy.Contains(backend.ID) {
+		return backend
+	}
+	for _, candidate := range d.table.LookupN(key, d.unhealthy.Len()+1) {
+		if !d.unhealthy.Contains(candidate.ID) {
+			return candidate
+		}
+	}
+	return backend // every candidate is unhealthy
+}
+
+// SetHealthy records one source's transition of the backend with the
+// given ID; it is skipped while any source reports it unhealthy
+func (d *Dispatcher) SetHealthy(id string, healthy bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.unhealthy.Report(id, healthy)
+}
+
+// SetLoadTracker enables bounded-load routing against the given tracker
+func (d *Dispatcher) SetLoadTracker(lt *maglev.LoadTracker) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.loads = lt
+}
+
+// LoadTracker returns the tracker used for bounded-load routing, if any
+func (d *Dispatcher) LoadTracker() *maglev.LoadTracker {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loads
+}
+
+func (d *Dispatcher) UpdateTable(t maglev.Balancer) {
+	d.mu.Lock()
 	oldTable := d.table
 	d.table = t
-	d.logger.Info("Updated Maglev table", "oldTable", oldTable.String(), "newTable", t.String()) // Info log for table update
+	d.mu.Unlock()
+	d.logger.Info("Updated Maglev table", "oldTable", fmt.Sprint(oldTable), "newTable", fmt.Sprint(t)) // Info log for table update
 }
@@ -0,0 +1,67 @@
+package dispatcher
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+func testTable(t *testing.T, n int) *maglev.Table {
+	t.Helper()
+	backends := make([]maglev.Backend, n)
+	for i := range backends {
+		backends[i] = maglev.Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), Weight: 1}
+	}
+	table, err := maglev.Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return table
+}
+
+func TestDispatcherSkipsUnhealthyBackend(t *testing.T) {
+	table := testTable(t, 5)
+	d := NewDispatcher(table, nil)
+
+	primary := table.Lookup("room-1").ID
+	next := table.LookupN("room-1", 2)[1].ID
+
+	// Two sources report the primary; it stays skipped until both recover
+	d.SetHealthy(primary, false)
+	d.SetHealthy(primary, false)
+	d.SetHealthy(primary, true)
+	if got := d.RouteByKey("room-1"); got != next {
+		t.Fatalf("RouteByKey = %s, want the next backend %s", got, next)
+	}
+	d.SetHealthy(primary, true)
+	if got := d.RouteByKey("room-1"); got != primary {
+		t.Fatalf("RouteByKey = %s after recovery, want %s", got, primary)
+	}
+}
+
+func TestDispatcherUpdateTableWhileRouting(t *testing.T) {
+	d := NewDispatcher(testTable(t, 3), nil)
+	next := testTable(t, 4)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range 1000 {
+			d.UpdateTable(next)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := range 1000 {
+			d.RouteByKey(fmt.Sprintf("room-%d", i))
+		}
+	}()
+	wg.Wait()
+
+	if got, want := d.RouteByKey("room-1"), next.Lookup("room-1").ID; got != want {
+		t.Fatalf("RouteByKey = %s, want %s from the updated table", got, want)
+	}
+}
@@ -0,0 +1,276 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// ProbeType selects how a backend is probed
+type ProbeType int
+
+const (
+	ProbeTCP  ProbeType = iota // TCP connect
+	ProbeHTTP                  // HTTP GET, healthy on 2xx/3xx
+)
+
+// Config configures a Checker
+type Config struct {
+	Type     ProbeType
+	Port     string        // e.g., "8080"
+	Path     string        // HTTP probe path, e.g., "/healthz"
+	Interval time.Duration // time between probe rounds
+	Timeout  time.Duration // per-probe timeout
+	Rise     int           // consecutive successes to become healthy
+	Fall     int           // consecutive failures to become unhealthy
+}
+
+// Transition reports a backend changing health
+type Transition struct {
+	Backend maglev.Backend
+	Healthy bool
+}
+
+// Consumer is anything that routes around unhealthy backends,
+// e.g., *maglev.VersionedRouter or *dispatcher.Dispatcher. Sources
+// only report transitions, so a consumer shared by several sources
+// must skip a backend until every source reports it healthy again.
+type Consumer interface {
+	SetHealthy(id string, healthy bool)
+}
+
+type target struct {
+	backend   maglev.Backend
+	healthy   bool
+	successes int
+	failures  int
+}
+
+// Checker actively probes the current backend set
+type Checker struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	targets map[string]*target // backend ID -> probe state
+	removed []Transition       // healthy transitions for removed unhealthy backends
+	wake    chan struct{}      // signals Run to send removed
+}
+
+// NewChecker returns a checker; zero Interval, Timeout, Rise and Fall
+// default to 5s, 1s, 2 and 3
+func NewChecker(cfg Config) (*Checker, error) {
+	if cfg.Port == "" {
+		return nil, errors.New("health check port is required")
+	}
+	if cfg.Type == ProbeHTTP && cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.Rise <= 0 {
+		cfg.Rise = 2
+	}
+	if cfg.Fall <= 0 {
+		cfg.Fall = 3
+	}
+
+	return &Checker{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// Report redirects as-is instead of following them
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		targets: make(map[string]*target),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// SetBackends replaces the probed set, e.g., on every watcher update.
+// New backends start healthy. Removed backends are forgotten, and Run
+// reports those that were unhealthy as healthy, so consumers do not
+// keep skipping their IDs if they come back.
+func (c *Checker) SetBackends(backends []maglev.Backend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := make(map[string]*target, len(backends))
+	for _, b := range backends {
+		if t, ok := c.targets[b.ID]; ok {
+			t.backend = b
+			next[b.ID] = t
+			continue
+		}
+		next[b.ID] = &target{backend: b, healthy: true}
+	}
+
+	for id, t := range c.targets {
+		if _, ok := next[id]; !ok && !t.healthy {
+			c.removed = append(c.removed, Transition{Backend: t.backend, Healthy: true})
+		}
+	}
+	if len(c.removed) > 0 {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+	c.targets = next
+}
+
+// Run probes all backends every interval until ctx is done, sending
+// each healthy/unhealthy transition on transitions.
+func (c *Checker) Run(ctx context.Context, transitions chan<- Transition) error {
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+
+	probe := true
+	for {
+		pending := c.takeRemoved()
+		if probe {
+			pending = append(pending, c.probeAll(ctx)...)
+		}
+		for _, t := range pending {
+			select {
+			case transitions <- t:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-ticker.C:
+			probe = true
+		case <-c.wake:
+			probe = false // only report removed backends
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// takeRemoved returns and clears the transitions of removed backends
+func (c *Checker) takeRemoved() []Transition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := c.removed
+	c.removed = nil
+	return removed
+}
+
+// probeAll probes every backend concurrently and returns the transitions
+func (c *Checker) probeAll(ctx context.Context) []Transition {
+	c.mu.Lock()
+	backends := make([]maglev.Backend, 0, len(c.targets))
+	for _, t := range c.targets {
+		backends = append(backends, t.backend)
+	}
+	c.mu.Unlock()
+
+	results := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.probe(ctx, b)
+		}()
+	}
+	wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var transitions []Transition
+	for i, b := range backends {
+		t, ok := c.targets[b.ID]
+		if !ok {
+			continue // removed while probing
+		}
+		if c.record(t, results[i] == nil) {
+			transitions = append(transitions, Transition{Backend: t.backend, Healthy: t.healthy})
+		}
+	}
+	return transitions
+}
+
+// record applies a probe result and reports whether health changed
+func (c *Checker) record(t *target, ok bool) bool {
+	if ok {
+		t.successes++
+		t.failures = 0
+		if !t.healthy && t.successes >= c.cfg.Rise {
+			t.healthy = true
+			return true
+		}
+		return false
+	}
+
+	t.failures++
+	t.successes = 0
+	if t.healthy && t.failures >= c.cfg.Fall {
+		t.healthy = false
+		return true
+	}
+	return false
+}
+
+func (c *Checker) probe(ctx context.Context, b maglev.Backend) error {
+	addr := b.Addr(c.cfg.Port)
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	if c.cfg.Type == ProbeTCP {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+c.cfg.Path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unhealthy status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Apply forwards transitions to consumers until the channel closes or ctx is done
+func Apply(ctx context.Context, transitions <-chan Transition, consumers ...Consumer) {
+	for {
+		select {
+		case t, ok := <-transitions:
+			if !ok {
+				return
+			}
+			for _, c := range consumers {
+				c.SetHealthy(t.Backend.ID, t.Healthy)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
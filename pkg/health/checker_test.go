@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// closedPort returns a local port with nothing listening on it
+func closedPort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+	return port
+}
+
+func receive(t *testing.T, transitions <-chan Transition) Transition {
+	t.Helper()
+	select {
+	case tr := <-transitions:
+		return tr
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a transition")
+		return Transition{}
+	}
+}
+
+func TestCheckerReportsRemovedUnhealthyBackendsHealthy(t *testing.T) {
+	checker, err := NewChecker(Config{Port: closedPort(t), Interval: time.Hour, Fall: 1})
+	if err != nil {
+		t.Fatalf("NewChecker: %v", err)
+	}
+	backend := maglev.Backend{ID: "127.0.0.1"}
+	checker.SetBackends([]maglev.Backend{backend})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	transitions := make(chan Transition)
+	go checker.Run(ctx, transitions)
+
+	if tr := receive(t, transitions); tr.Backend.ID != backend.ID || tr.Healthy {
+		t.Fatalf("got %+v, want %s unhealthy", tr, backend.ID)
+	}
+
+	checker.SetBackends(nil)
+	if tr := receive(t, transitions); tr.Backend.ID != backend.ID || !tr.Healthy {
+		t.Fatalf("got %+v, want removed %s healthy", tr, backend.ID)
+	}
+}
@@ -0,0 +1,166 @@
+package health
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// OutlierConfig configures an OutlierDetector
+type OutlierConfig struct {
+	ConsecutiveErrors int           // 5xx or connection errors before ejection
+	BaseEjection      time.Duration // first ejection; doubles on each repeat
+	MaxEjection       time.Duration // cap on ejection time; also resets the backoff
+	MaxEjectedPercent int           // cap on the share of backends ejected at once
+}
+
+type outlier struct {
+	errors     int
+	ejections  int // consecutive ejections, for the backoff
+	ejected    bool
+	releasedAt time.Time
+}
+
+// OutlierDetector passively ejects backends that keep failing requests.
+// Ejected backends are reported unhealthy to the consumers and reported
+// healthy again once their ejection time passes.
+// A nil *OutlierDetector is valid and ignores reports.
+type OutlierDetector struct {
+	cfg       OutlierConfig
+	consumers []Consumer
+
+	mu       sync.Mutex
+	backends map[string]*outlier // backend ID -> detection state
+}
+
+// NewOutlierDetector returns a detector feeding ejections to consumers.
+// Zero config fields default to 5 errors, 30s, 5m and 10%.
+func NewOutlierDetector(cfg OutlierConfig, consumers ...Consumer) *OutlierDetector {
+	if cfg.ConsecutiveErrors <= 0 {
+		cfg.ConsecutiveErrors = 5
+	}
+	if cfg.BaseEjection <= 0 {
+		cfg.BaseEjection = 30 * time.Second
+	}
+	if cfg.MaxEjection <= 0 {
+		cfg.MaxEjection = 5 * time.Minute
+	}
+	if cfg.MaxEjectedPercent <= 0 {
+		cfg.MaxEjectedPercent = 10
+	}
+
+	return &OutlierDetector{
+		cfg:       cfg,
+		consumers: consumers,
+		backends:  make(map[string]*outlier),
+	}
+}
+
+// SetBackends replaces the tracked set, e.g., on every watcher update.
+// State of remaining backends is kept; removed backends are forgotten,
+// and those still ejected are released in the consumers.
+func (o *OutlierDetector) SetBackends(backends []maglev.Backend) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	next := make(map[string]*outlier, len(backends))
+	for _, b := range backends {
+		if s, ok := o.backends[b.ID]; ok {
+			next[b.ID] = s
+			continue
+		}
+		next[b.ID] = &outlier{}
+	}
+
+	for id, s := range o.backends {
+		if _, ok := next[id]; !ok && s.ejected {
+			o.notify(id, true)
+		}
+	}
+	o.backends = next
+}
+
+// Report records the outcome of a request to the backend; ok is false
+// for 5xx responses and connection errors
+func (o *OutlierDetector) Report(id string, ok bool) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s, tracked := o.backends[id]
+	if !tracked || s.ejected {
+		return
+	}
+	if ok {
+		s.errors = 0
+		return
+	}
+
+	s.errors++
+	if s.errors < o.cfg.ConsecutiveErrors || !o.canEject() {
+		return
+	}
+
+	// Start the backoff over once a backend has stayed in for MaxEjection
+	if time.Since(s.releasedAt) > o.cfg.MaxEjection {
+		s.ejections = 0
+	}
+	s.ejections++
+	s.ejected = true
+	s.errors = 0
+
+	duration := o.cfg.BaseEjection << min(s.ejections-1, 30)
+	if duration <= 0 || duration > o.cfg.MaxEjection {
+		duration = o.cfg.MaxEjection
+	}
+	time.AfterFunc(duration, func() { o.release(id, s) })
+
+	o.notify(id, false)
+}
+
+// Ejected reports whether the backend is currently ejected
+func (o *OutlierDetector) Ejected(id string) bool {
+	if o == nil {
+		return false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s, ok := o.backends[id]
+	return ok && s.ejected
+}
+
+// canEject reports whether one more ejection stays within MaxEjectedPercent
+func (o *OutlierDetector) canEject() bool {
+	ejected := 0
+	for _, s := range o.backends {
+		if s.ejected {
+			ejected++
+		}
+	}
+	return ejected*100 < o.cfg.MaxEjectedPercent*len(o.backends)
+}
+
+func (o *OutlierDetector) release(id string, s *outlier) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s.ejected = false
+	s.releasedAt = time.Now()
+
+	// Only notify for backends still in the current set
+	if o.backends[id] == s {
+		o.notify(id, true)
+	}
+}
+
+func (o *OutlierDetector) notify(id string, healthy bool) {
+	for _, c := range o.consumers {
+		c.SetHealthy(id, healthy)
+	}
+}
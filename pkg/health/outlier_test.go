@@ -0,0 +1,65 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+func TestOutlierDetectorReleasesRemovedBackends(t *testing.T) {
+	router := maglev.NewVersionedRouter(1)
+	detector := NewOutlierDetector(OutlierConfig{
+		ConsecutiveErrors: 1,
+		BaseEjection:      time.Hour,
+		MaxEjectedPercent: 100,
+	}, router)
+
+	backends := []maglev.Backend{{ID: "a"}, {ID: "b"}}
+	detector.SetBackends(backends)
+	detector.Report("a", false)
+	if router.Healthy("a") {
+		t.Fatal("ejected backend is healthy in the router")
+	}
+
+	detector.SetBackends(backends[1:])
+	if !router.Healthy("a") {
+		t.Fatal("removed backend is still unhealthy in the router")
+	}
+
+	// A backend that comes back starts over
+	detector.SetBackends(backends)
+	if detector.Ejected("a") || !router.Healthy("a") {
+		t.Fatal("re-added backend is still ejected")
+	}
+}
+
+func TestOutlierDetectorAndCheckerShareConsumer(t *testing.T) {
+	router := maglev.NewVersionedRouter(1)
+	detector := NewOutlierDetector(OutlierConfig{
+		ConsecutiveErrors: 1,
+		BaseEjection:      10 * time.Millisecond,
+		MaxEjectedPercent: 100,
+	}, router)
+	detector.SetBackends([]maglev.Backend{{ID: "a"}})
+
+	// The checker reports "a" down while it is ejected
+	router.SetHealthy("a", false)
+	detector.Report("a", false)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for detector.Ejected("a") {
+		if time.Now().After(deadline) {
+			t.Fatal("backend was never released")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if router.Healthy("a") {
+		t.Fatal("release cleared the checker's unhealthy report")
+	}
+
+	router.SetHealthy("a", true)
+	if !router.Healthy("a") {
+		t.Fatal("backend is unhealthy after every source reported it healthy")
+	}
+}
@@ -0,0 +1,110 @@
+package maglev
+
+import "slices"
+
+// Balancer maps keys to backends. *Table implements it with Maglev
+// hashing; package balancer provides alternative algorithms.
+type Balancer interface {
+	// Lookup returns the backend for a given key
+	Lookup(key string) Backend
+	// LookupN returns up to `n` unique backends in preference order
+	LookupN(key string, n int) []Backend
+	// LookupNWithDomainIsolation returns up to `count` backends from
+	// distinct failure domains, examining at most `maxJumps` candidates
+	LookupNWithDomainIsolation(key string, count, maxJumps int) []Backend
+}
+
+// BoundedBalancer is a Balancer that supports bounded-load lookups
+type BoundedBalancer interface {
+	Balancer
+	LookupBounded(key string, loads *LoadTracker) Backend
+}
+
+// SkippingBalancer is a Balancer whose domain-isolated lookup can pass
+// over backends while scanning, so later preferences take their place
+type SkippingBalancer interface {
+	Balancer
+	// LookupNWithDomainIsolationSkipping is LookupNWithDomainIsolation
+	// with every backend for which skip returns true passed over
+	LookupNWithDomainIsolationSkipping(key string, count, maxJumps int, skip func(Backend) bool) []Backend
+}
+
+// LookupBounded returns b's bounded-load backend for key, or its plain
+// Lookup if b does not support bounded loads or loads is nil
+func LookupBounded(b Balancer, key string, loads *LoadTracker) Backend {
+	if bb, ok := b.(BoundedBalancer); ok && loads != nil {
+		return bb.LookupBounded(key, loads)
+	}
+	return b.Lookup(key)
+}
+
+// LookupNGuaranteed returns b's domain-isolated backends for key and,
+// if fewer than `count`, fills the remainder in b's LookupN order
+// regardless of failure domain. `relaxed` reports whether any backend
+// shares a failure domain with one selected before it.
+func LookupNGuaranteed(b Balancer, key string, count, maxJumps int) (result []Backend, relaxed bool) {
+	return lookupNGuaranteed(b, key, count, maxJumps, nil)
+}
+
+// lookupNIsolated is b's LookupNWithDomainIsolation, passing over the
+// backends for which a non-nil skip returns true. Balancers that are
+// not SkippingBalancers drop them from the result instead.
+func lookupNIsolated(b Balancer, key string, count, maxJumps int, skip func(Backend) bool) []Backend {
+	if skip == nil {
+		return b.LookupNWithDomainIsolation(key, count, maxJumps)
+	}
+	if sb, ok := b.(SkippingBalancer); ok {
+		return sb.LookupNWithDomainIsolationSkipping(key, count, maxJumps, skip)
+	}
+	return slices.DeleteFunc(b.LookupNWithDomainIsolation(key, count, maxJumps), skip)
+}
+
+// lookupNGuaranteed is LookupNGuaranteed, passing over the backends for
+// which a non-nil skip returns true
+func lookupNGuaranteed(b Balancer, key string, count, maxJumps int, skip func(Backend) bool) (result []Backend, relaxed bool) {
+	if t, ok := b.(*Table); ok {
+		return t.lookupNGuaranteed(key, count, maxJumps, skip)
+	}
+
+	result = lookupNIsolated(b, key, count, maxJumps, skip)
+	if len(result) >= count {
+		return result, false
+	}
+
+	isolated := len(result)
+	seen := make(map[string]struct{}, len(result))
+	for _, backend := range result {
+		seen[backend.ID] = struct{}{}
+	}
+	// Skipped backends take up LookupN entries, so widen until filled
+	for n := count; len(result) < count; n *= 2 {
+		candidates := b.LookupN(key, n)
+		for _, backend := range candidates {
+			if len(result) >= count {
+				break
+			}
+			if _, ok := seen[backend.ID]; ok || (skip != nil && skip(backend)) {
+				continue
+			}
+			seen[backend.ID] = struct{}{}
+			result = append(result, backend)
+		}
+		if len(candidates) < n {
+			break
+		}
+	}
+	return result, sharesDomain(result, isolated)
+}
+
+// sharesDomain reports whether any backend from index `from` on shares a
+// failure domain with a backend before it
+func sharesDomain(backends []Backend, from int) bool {
+	for i := from; i < len(backends); i++ {
+		for _, prev := range backends[:i] {
+			if prev.FailureDomain == backends[i].FailureDomain {
+				return true
+			}
+		}
+	}
+	return false
+}
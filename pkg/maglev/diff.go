@@ -0,0 +1,107 @@
+package maglev
+
+import (
+	"errors"
+	"slices"
+)
+
+// SlotDelta counts the slots a backend gained and lost between two tables
+type SlotDelta struct {
+	Gained int
+	Lost   int
+}
+
+// DiffReport describes how slot ownership changed between two tables
+type DiffReport struct {
+	MovedSlots     []int                // slot indices whose backend changed
+	MovedFraction  float64              // fraction of the keyspace reassigned
+	BackendChanges map[string]SlotDelta // backend ID -> slots gained/lost
+}
+
+// KeyChange describes how routing for a single key changed between two tables
+type KeyChange struct {
+	Key            string
+	OldPrimary     Backend
+	NewPrimary     Backend
+	OldPeers       []Backend
+	NewPeers       []Backend
+	PrimaryChanged bool
+	PeersChanged   bool
+}
+
+// Diff compares slot ownership of two tables of the same size
+func Diff(old, new *Table) (*DiffReport, error) {
+	if old == nil || new == nil {
+		return nil, errors.New("nil table")
+	}
+	if old.m != new.m {
+		return nil, errors.New("tables differ in size")
+	}
+
+	report := &DiffReport{
+		BackendChanges: make(map[string]SlotDelta),
+	}
+	for slot := range new.m {
+		oldID := old.backends[old.slots.at(slot)].ID
+		newID := new.backends[new.slots.at(slot)].ID
+		if oldID == newID {
+			continue
+		}
+		report.MovedSlots = append(report.MovedSlots, slot)
+
+		lost := report.BackendChanges[oldID]
+		lost.Lost++
+		report.BackendChanges[oldID] = lost
+
+		gained := report.BackendChanges[newID]
+		gained.Gained++
+		report.BackendChanges[newID] = gained
+	}
+	report.MovedFraction = float64(len(report.MovedSlots)) / float64(new.m)
+
+	return report, nil
+}
+
+// DiffKeys reports, for each key, whether its primary or its
+// domain-isolated replica peers differ between two tables.
+func DiffKeys(old, new *Table, keys []string, replicationCount, maxJumps int) []KeyChange {
+	changes := make([]KeyChange, 0, len(keys))
+	for _, key := range keys {
+		oldPrimary, oldPeers := splitPrimary(old.LookupNWithDomainIsolation(key, replicationCount, maxJumps))
+		newPrimary, newPeers := splitPrimary(new.LookupNWithDomainIsolation(key, replicationCount, maxJumps))
+
+		changes = append(changes, KeyChange{
+			Key:            key,
+			OldPrimary:     oldPrimary,
+			NewPrimary:     newPrimary,
+			OldPeers:       oldPeers,
+			NewPeers:       newPeers,
+			PrimaryChanged: oldPrimary.ID != newPrimary.ID,
+			PeersChanged:   !samePeerIDs(oldPeers, newPeers),
+		})
+	}
+	return changes
+}
+
+func splitPrimary(backends []Backend) (Backend, []Backend) {
+	if len(backends) == 0 {
+		return Backend{}, nil
+	}
+	return backends[0], backends[1:]
+}
+
+// samePeerIDs reports whether two peer lists hold the same backend IDs, ignoring order
+func samePeerIDs(a, b []Backend) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := func(backends []Backend) []string {
+		out := make([]string, len(backends))
+		for i, backend := range backends {
+			out[i] = backend.ID
+		}
+		slices.Sort(out)
+		return out
+	}
+	return slices.Equal(ids(a), ids(b))
+}
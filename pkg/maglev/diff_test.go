@@ -0,0 +1,132 @@
+package maglev
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// removeOne builds tables with and without the first of n backends
+func removeOne(t *testing.T, n, tableSize int) (old, new *Table, removed Backend) {
+	t.Helper()
+	backends := testBackends(n)
+	old, err := Build(backends, tableSize)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	new, err = Build(backends[1:], tableSize)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return old, new, backends[0]
+}
+
+func TestDiffRemovedBackend(t *testing.T) {
+	old, new, removed := removeOne(t, 20, 5003)
+
+	report, err := Diff(old, new)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+
+	// Every slot of the removed backend moves, and little else does
+	removedSlots := slotCounts(old)[removed.ID]
+	if delta := report.BackendChanges[removed.ID]; delta != (SlotDelta{Lost: removedSlots}) {
+		t.Fatalf("removed backend delta = %+v, want %d lost", delta, removedSlots)
+	}
+	if got := len(report.MovedSlots); got < removedSlots || got > 2*removedSlots {
+		t.Fatalf("%d slots moved, want between %d and %d", got, removedSlots, 2*removedSlots)
+	}
+	if want := float64(len(report.MovedSlots)) / 5003; report.MovedFraction != want {
+		t.Fatalf("MovedFraction = %v, want %v", report.MovedFraction, want)
+	}
+
+	var gained, lost int
+	for _, delta := range report.BackendChanges {
+		gained += delta.Gained
+		lost += delta.Lost
+	}
+	if gained != len(report.MovedSlots) || lost != len(report.MovedSlots) {
+		t.Fatalf("gained %d, lost %d, want %d each", gained, lost, len(report.MovedSlots))
+	}
+
+	oldIDs, newIDs := slotIndices(old), slotIndices(new)
+	for _, slot := range report.MovedSlots {
+		if oldIDs[slot] == newIDs[slot] {
+			t.Fatalf("slot %d reported as moved but kept %s", slot, oldIDs[slot])
+		}
+	}
+}
+
+func TestDiffRejectsMismatchedTables(t *testing.T) {
+	small, _ := Build(testBackends(3), 1009)
+	large, _ := Build(testBackends(3), 5003)
+	if _, err := Diff(small, large); err == nil {
+		t.Fatal("Diff succeeded for tables of different sizes")
+	}
+	if _, err := Diff(nil, large); err == nil {
+		t.Fatal("Diff succeeded for a nil table")
+	}
+}
+
+func TestDiffKeysRemovedBackend(t *testing.T) {
+	old, new, removed := removeOne(t, 20, 5003)
+
+	keys := make([]string, 500)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("room-%d", i)
+	}
+	changes := DiffKeys(old, new, keys, 3, 20)
+	if len(changes) != len(keys) {
+		t.Fatalf("got %d changes for %d keys", len(changes), len(keys))
+	}
+
+	var primaryMoves, peerMoves int
+	for _, change := range changes {
+		if change.OldPrimary != old.Lookup(change.Key) || change.NewPrimary != new.Lookup(change.Key) {
+			t.Fatalf("%s: primaries %s -> %s do not match Lookup", change.Key, change.OldPrimary.ID, change.NewPrimary.ID)
+		}
+		if change.PrimaryChanged != (change.OldPrimary.ID != change.NewPrimary.ID) {
+			t.Fatalf("%s: PrimaryChanged = %v for %s -> %s", change.Key, change.PrimaryChanged, change.OldPrimary.ID, change.NewPrimary.ID)
+		}
+
+		// Keys that lose their primary or a peer to the removal must report it
+		if change.OldPrimary.ID == removed.ID {
+			primaryMoves++
+			if !change.PrimaryChanged {
+				t.Fatalf("%s: primary was removed but PrimaryChanged is false", change.Key)
+			}
+		}
+		if slices.ContainsFunc(change.OldPeers, func(b Backend) bool { return b.ID == removed.ID }) {
+			peerMoves++
+			if !change.PeersChanged {
+				t.Fatalf("%s: peer was removed but PeersChanged is false", change.Key)
+			}
+		}
+		if change.NewPrimary.ID == removed.ID || slices.ContainsFunc(change.NewPeers, func(b Backend) bool { return b.ID == removed.ID }) {
+			t.Fatalf("%s: still routed to the removed backend", change.Key)
+		}
+	}
+	if primaryMoves == 0 || peerMoves == 0 {
+		t.Fatalf("removed backend was primary for %d keys and a peer for %d, want both non-zero", primaryMoves, peerMoves)
+	}
+}
+
+func TestAddGenerationReturnsDiff(t *testing.T) {
+	old, new, _ := removeOne(t, 20, 5003)
+
+	vr := NewVersionedRouter(3)
+	if report := vr.AddGeneration(1, old); report != nil {
+		t.Fatalf("first generation diff = %+v, want nil", report)
+	}
+
+	report := vr.AddGeneration(2, new)
+	want, _ := Diff(old, new)
+	if report == nil || !slices.Equal(report.MovedSlots, want.MovedSlots) {
+		t.Fatalf("AddGeneration diff does not match Diff")
+	}
+
+	if report := vr.AddGeneration(2, old); report != nil {
+		t.Fatal("re-adding an existing generation returned a diff")
+	}
+}
@@ -0,0 +1,81 @@
+package maglev
+
+import "strings"
+
+// FailureDomainSeparator splits a hierarchical failure domain into
+// levels, outermost first (e.g., "zone-a/node-1").
+const FailureDomainSeparator = "/"
+
+// Placement is a backend selected by a hierarchical lookup, with the
+// level at which it is isolated from every backend selected before it.
+// Level 0 is the outermost (e.g., zone), level 1 the next (e.g., node).
+type Placement struct {
+	Backend Backend
+	Level   int
+}
+
+// domainPrefix returns the first levels+1 components of a failure domain
+func domainPrefix(domain string, level int) string {
+	idx := 0
+	for range level + 1 {
+		next := strings.Index(domain[idx:], FailureDomainSeparator)
+		if next < 0 {
+			return domain
+		}
+		idx += next + len(FailureDomainSeparator)
+	}
+	return domain[:idx-len(FailureDomainSeparator)]
+}
+
+// domainDepth returns the number of levels in a failure domain
+func domainDepth(domain string) int {
+	return strings.Count(domain, FailureDomainSeparator) + 1
+}
+
+// LookupNWithHierarchicalIsolation returns up to `count` distinct
+// backends, spreading them across the outermost failure domain level
+// first. Each pass rescans up to `maxJumps` slots and, when the
+// previous level ran out of distinct domains, relaxes isolation to the
+// next inner level. Backends sharing a full failure domain are never
+// both selected.
+func (t *Table) LookupNWithHierarchicalIsolation(key string, count, maxJumps int) []Placement {
+	if count <= 0 || maxJumps <= 0 || t.m == 0 {
+		return nil
+	}
+
+	depth := 0
+	for _, b := range t.backends {
+		depth = max(depth, domainDepth(b.FailureDomain))
+	}
+
+	result := make([]Placement, 0, count)
+	seenBackends := make(map[int]struct{}) // backend index
+	start := t.slotFor(key)
+
+	for level := 0; level < depth && len(result) < count; level++ {
+		// Domains at this level already occupied by selected backends
+		seenDomains := make(map[string]struct{})
+		for _, p := range result {
+			seenDomains[domainPrefix(p.Backend.FailureDomain, level)] = struct{}{}
+		}
+
+		for i := 0; len(result) < count && i < maxJumps; i++ {
+			backendIdx := t.slots.at((start + i) % t.m)
+			if _, seen := seenBackends[backendIdx]; seen {
+				continue
+			}
+
+			backend := t.backends[backendIdx]
+			domain := domainPrefix(backend.FailureDomain, level)
+			if _, domainSeen := seenDomains[domain]; domainSeen {
+				continue
+			}
+
+			result = append(result, Placement{Backend: backend, Level: level})
+			seenBackends[backendIdx] = struct{}{}
+			seenDomains[domain] = struct{}{}
+		}
+	}
+
+	return result
+}
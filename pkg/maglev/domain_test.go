@@ -0,0 +1,104 @@
+package maglev
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDomainPrefix(t *testing.T) {
+	tests := []struct {
+		domain string
+		level  int
+		want   string
+	}{
+		{"zone-a/node-1", 0, "zone-a"},
+		{"zone-a/node-1", 1, "zone-a/node-1"},
+		{"zone-a/node-1", 5, "zone-a/node-1"},
+		{"zone-a", 0, "zone-a"},
+		{"", 0, ""},
+	}
+	for _, tt := range tests {
+		if got := domainPrefix(tt.domain, tt.level); got != tt.want {
+			t.Errorf("domainPrefix(%q, %d) = %q, want %q", tt.domain, tt.level, got, tt.want)
+		}
+	}
+}
+
+// zoneNodeBackends returns one backend per node, with nodesPerZone nodes
+// in each of the given number of zones
+func zoneNodeBackends(zones, nodesPerZone int) []Backend {
+	var backends []Backend
+	for z := range zones {
+		for n := range nodesPerZone {
+			backends = append(backends, Backend{
+				ID:            fmt.Sprintf("10.0.%d.%d", z, n+1),
+				FailureDomain: fmt.Sprintf("zone-%d/node-%d", z, n),
+				Weight:        1,
+			})
+		}
+	}
+	return backends
+}
+
+func TestLookupNWithHierarchicalIsolationFallsBackToNodes(t *testing.T) {
+	// Two zones cannot hold four replicas, so the last two spread by node
+	table, err := Build(zoneNodeBackends(2, 3), 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	for i := range 100 {
+		key := fmt.Sprintf("room-%d", i)
+		got := table.LookupNWithHierarchicalIsolation(key, 4, 1009)
+		if len(got) != 4 {
+			t.Fatalf("%s: got %d placements, want 4", key, len(got))
+		}
+
+		zones := make(map[string]struct{})
+		nodes := make(map[string]struct{})
+		for j, p := range got {
+			wantLevel := 0
+			if j >= 2 {
+				wantLevel = 1
+			}
+			if p.Level != wantLevel {
+				t.Fatalf("%s: placement %d at level %d, want %d", key, j, p.Level, wantLevel)
+			}
+			if _, dup := nodes[p.Backend.FailureDomain]; dup {
+				t.Fatalf("%s: node %s selected twice", key, p.Backend.FailureDomain)
+			}
+			nodes[p.Backend.FailureDomain] = struct{}{}
+			zones[domainPrefix(p.Backend.FailureDomain, 0)] = struct{}{}
+			if j == 1 && len(zones) != 2 {
+				t.Fatalf("%s: first two placements share a zone: %+v", key, got[:2])
+			}
+		}
+
+		if got[0].Backend != table.Lookup(key) {
+			t.Fatalf("%s: first placement %s is not the primary", key, got[0].Backend.ID)
+		}
+	}
+}
+
+func TestLookupNWithHierarchicalIsolationStopsAtFullDomain(t *testing.T) {
+	// Backends sharing a node are never both selected, whatever the count
+	backends := zoneNodeBackends(2, 2)
+	backends = append(backends, Backend{ID: "10.0.0.9", FailureDomain: "zone-0/node-0", Weight: 1})
+	table, err := Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	for i := range 100 {
+		key := fmt.Sprintf("room-%d", i)
+		got := table.LookupNWithHierarchicalIsolation(key, len(backends), 1009)
+		if len(got) != 4 {
+			t.Fatalf("%s: got %d placements, want one per node", key, len(got))
+		}
+		for j, p := range got {
+			if wantLevel := min(j/2, 1); p.Level != wantLevel {
+				t.Fatalf("%s: placement %d at level %d, want %d", key, j, p.Level, wantLevel)
+			}
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package maglev
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+)
+
+// Binary table format (little endian):
+//
+//	magic      [4]byte "MGLV"
+//	version    uint8
+//	hasher     uint8 key, uint8 offset, uint8 skip
+//	indexWidth uint8 bytes per slot (1, 2 or 4)
+//	tableSize  uint32
+//	numBackends uint32
+//	backends   per backend: uvarint len + ID, uvarint len + FailureDomain, uint32 Weight,
+//	           uvarint len + Address (version 2 and later)
+//	slots      tableSize × indexWidth backend indices
+//	checksum   uint32 CRC-32 (IEEE) of all preceding bytes
+const (
+	encodingMagic   = "MGLV"
+	encodingVersion = 2
+)
+
+// MarshalBinary encodes the table in a compact, versioned format
+func (t *Table) MarshalBinary() ([]byte, error) {
+	if uint64(t.m) > math.MaxUint32 || uint64(len(t.backends)) > math.MaxUint32 {
+		return nil, errors.New("table too large to encode")
+	}
+
+	width := t.slots.width()
+	buf := make([]byte, 0, 16+len(t.backends)*32+t.m*width+4)
+
+	buf = append(buf, encodingMagic...)
+	buf = append(buf, encodingVersion)
+	buf = append(buf, byte(t.hasher.Key), byte(t.hasher.Offset), byte(t.hasher.Skip))
+	buf = append(buf, byte(width))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(t.m))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.backends)))
+
+	for _, b := range t.backends {
+		buf = binary.AppendUvarint(buf, uint64(len(b.ID)))
+		buf = append(buf, b.ID...)
+		buf = binary.AppendUvarint(buf, uint64(len(b.FailureDomain)))
+		buf = append(buf, b.FailureDomain...)
+		buf = binary.LittleEndian.AppendUint32(buf, b.Weight)
+		buf = binary.AppendUvarint(buf, uint64(len(b.Address)))
+		buf = append(buf, b.Address...)
+	}
+
+	switch width {
+	case 1:
+		buf = append(buf, t.slots.u8...)
+	case 2:
+		for _, idx := range t.slots.u16 {
+			buf = binary.LittleEndian.AppendUint16(buf, idx)
+		}
+	default:
+		for _, idx := range t.slots.u32 {
+			buf = binary.LittleEndian.AppendUint32(buf, idx)
+		}
+	}
+
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf)), nil
+}
+
+// UnmarshalBinary decodes a table produced by MarshalBinary
+func (t *Table) UnmarshalBinary(data []byte) error {
+	if len(data) < len(encodingMagic)+4 || string(data[:len(encodingMagic)]) != encodingMagic {
+		return errors.New("not a maglev table")
+	}
+
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return errors.New("table checksum mismatch")
+	}
+
+	d := decoder{buf: body[len(encodingMagic):]}
+	version := d.byte()
+	if version < 1 || version > encodingVersion {
+		return fmt.Errorf("unsupported table encoding version: %d", version)
+	}
+
+	h := Hasher{
+		Key:    HashAlgorithm(d.byte()),
+		Offset: HashAlgorithm(d.byte()),
+		Skip:   HashAlgorithm(d.byte()),
+	}
+	width := int(d.byte())
+	tableSize := int(d.uint32())
+	numBackends := int(d.uint32())
+	if d.err != nil {
+		return d.err
+	}
+	if err := h.validate(); err != nil {
+		return err
+	}
+	if width != indexWidth(numBackends) || tableSize == 0 || numBackends == 0 {
+		return errors.New("invalid table header")
+	}
+	if err := validateTableSize(tableSize); err != nil {
+		return err
+	}
+
+	backends := make([]Backend, 0, min(numBackends, len(d.buf)))
+	for range numBackends {
+		b := Backend{
+			ID:            d.string(),
+			FailureDomain: d.string(),
+			Weight:        d.uint32(),
+		}
+		if version >= 2 {
+			b.Address = d.string()
+		}
+		backends = append(backends, b)
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	if len(d.buf) != tableSize*width {
+		return errors.New("invalid table slot data")
+	}
+	slots := make([]int, tableSize)
+	for i := range slots {
+		var idx int
+		switch width {
+		case 1:
+			idx = int(d.buf[i])
+		case 2:
+			idx = int(binary.LittleEndian.Uint16(d.buf[i*2:]))
+		default:
+			idx = int(binary.LittleEndian.Uint32(d.buf[i*4:]))
+		}
+		if idx >= numBackends {
+			return fmt.Errorf("slot %d references unknown backend %d", i, idx)
+		}
+		slots[i] = idx
+	}
+
+	*t = *newTable(backends, slots, h, 1)
+	return nil
+}
+
+// decoder reads fields sequentially, recording the first error
+type decoder struct {
+	buf []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated table data")
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.buf) < 1 {
+		d.err = cmp.Or(d.err, errTruncated)
+		return 0
+	}
+	b := d.buf[0]
+	d.buf = d.buf[1:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	if d.err != nil || len(d.buf) < 4 {
+		d.err = cmp.Or(d.err, errTruncated)
+		return 0
+	}
+	v := binary.LittleEndian.Uint32(d.buf)
+	d.buf = d.buf[4:]
+	return v
+}
+
+func (d *decoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	n, read := binary.Uvarint(d.buf)
+	if read <= 0 || n > uint64(len(d.buf)-read) {
+		d.err = errTruncated
+		return ""
+	}
+	s := string(d.buf[read : read+int(n)])
+	d.buf = d.buf[read+int(n):]
+	return s
+}
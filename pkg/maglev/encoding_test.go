@@ -0,0 +1,150 @@
+package maglev
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func encodingTestTable(t *testing.T, numBackends int) *Table {
+	t.Helper()
+	backends := testBackends(numBackends)
+	for i := range backends {
+		backends[i].Address = backends[i].ID + ":8080"
+	}
+	backends[0].Weight = 0 // a standby backend round-trips too
+	table, err := Build(backends, 5003, WithHasher(Hasher{Key: HashXXHash64, Offset: HashMurmur3, Skip: HashFNV1a}))
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	return table
+}
+
+// resum replaces the trailing checksum of an encoded table
+func resum(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.LittleEndian.AppendUint32(slices.Clone(body), crc32.ChecksumIEEE(body))
+}
+
+func assertSameTable(t *testing.T, got, want *Table) {
+	t.Helper()
+	if !slices.Equal(got.backends, want.backends) {
+		t.Fatalf("backends = %+v, want %+v", got.backends, want.backends)
+	}
+	if got.hasher != want.hasher {
+		t.Fatalf("hasher = %+v, want %+v", got.hasher, want.hasher)
+	}
+	if !slices.Equal(slotIndices(got), slotIndices(want)) {
+		t.Fatal("slots differ")
+	}
+	if !slices.Equal(got.standby, want.standby) {
+		t.Fatalf("standby = %v, want %v", got.standby, want.standby)
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	// One- and two-byte slot indices
+	for _, numBackends := range []int{5, 300} {
+		want := encodingTestTable(t, numBackends)
+		data, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary: %v", err)
+		}
+
+		var got Table
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary: %v", err)
+		}
+		assertSameTable(t, &got, want)
+		for _, key := range testKeys(100) {
+			if got.LookupBytes(key) != want.LookupBytes(key) {
+				t.Fatalf("Lookup(%q) differs after a round trip", key)
+			}
+		}
+	}
+}
+
+func TestEncodingRejectsCorruption(t *testing.T) {
+	data, err := encodingTestTable(t, 5).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	corrupted := slices.Clone(data)
+	corrupted[len(corrupted)/2] ^= 0xff
+	if err := new(Table).UnmarshalBinary(corrupted); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("corrupted byte: err = %v, want a checksum mismatch", err)
+	}
+
+	if err := new(Table).UnmarshalBinary(data[:len(data)-10]); err == nil {
+		t.Fatal("truncated data decoded")
+	}
+
+	// A valid checksum over truncated data still fails to decode
+	for _, n := range []int{12, 30, len(data) - 8} {
+		if err := new(Table).UnmarshalBinary(resum(data[:n+4])); err == nil {
+			t.Fatalf("data truncated to %d bytes decoded", n)
+		}
+	}
+	err = new(Table).UnmarshalBinary(resum(data[:len(encodingMagic)+8+4]))
+	if !errors.Is(err, errTruncated) {
+		t.Fatalf("header truncated: err = %v, want %v", err, errTruncated)
+	}
+}
+
+func TestEncodingRejectsUnknownVersion(t *testing.T) {
+	data, err := encodingTestTable(t, 5).MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	for _, version := range []byte{0, encodingVersion + 1} {
+		bad := slices.Clone(data)
+		bad[len(encodingMagic)] = version
+		err := new(Table).UnmarshalBinary(resum(bad))
+		if err == nil || !strings.Contains(err.Error(), "version") {
+			t.Fatalf("version %d: err = %v, want an unsupported version", version, err)
+		}
+	}
+
+	if err := new(Table).UnmarshalBinary([]byte("not a table")); err == nil {
+		t.Fatal("decoded data without the magic")
+	}
+}
+
+// marshalV1 encodes t in version 1 of the format, without addresses
+func marshalV1(t *Table) []byte {
+	buf := append([]byte(encodingMagic), 1)
+	buf = append(buf, byte(t.hasher.Key), byte(t.hasher.Offset), byte(t.hasher.Skip))
+	buf = append(buf, byte(t.slots.width()))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(t.m))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(t.backends)))
+	for _, b := range t.backends {
+		buf = binary.AppendUvarint(buf, uint64(len(b.ID)))
+		buf = append(buf, b.ID...)
+		buf = binary.AppendUvarint(buf, uint64(len(b.FailureDomain)))
+		buf = append(buf, b.FailureDomain...)
+		buf = binary.LittleEndian.AppendUint32(buf, b.Weight)
+	}
+	buf = append(buf, t.slots.u8...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+func TestEncodingDecodesVersion1(t *testing.T) {
+	table := encodingTestTable(t, 5)
+
+	var got Table
+	if err := got.UnmarshalBinary(marshalV1(table)); err != nil {
+		t.Fatalf("UnmarshalBinary: %v", err)
+	}
+
+	want := *table
+	want.backends = slices.Clone(table.backends)
+	for i := range want.backends {
+		want.backends[i].Address = ""
+	}
+	assertSameTable(t, &got, &want)
+}
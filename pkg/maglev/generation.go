@@ -3,6 +3,7 @@ package maglev
 import (
 	"strconv"
 	"sync"
+	"time"
 )
 
 const (
@@ -10,31 +11,70 @@ const (
 	HeaderReplicationPeers = "X-Maglev-Replication-Peers"
 	HeaderPreviousPeers    = "X-Maglev-Previous-Peers"
 	HeaderPreviousPrimary  = "X-Maglev-Previous-Primary"
+	HeaderOwner            = "X-Maglev-Owner"
+	HeaderUnderReplicated  = "X-Maglev-Under-Replicated"
+	HeaderTemporaryOwner   = "X-Maglev-Temporary-Owner"
+	HeaderFailover         = "X-Maglev-Failover"
 )
 
 type VersionedRouter struct {
 	mu         sync.RWMutex
-	tables     map[uint64]*Table // generation → table
-	order      []uint64          // oldest first
+	tables     map[uint64]Balancer // generation → table
+	order      []uint64            // oldest first
 	maxHistory int
 	currentGen uint64
+	loads      *LoadTracker            // bounded-load mode when non-nil
+	guarantee  bool                    // relax domain isolation to fill the replica count
+	states     map[string]backendState // backend ID → non-active state
+	unhealthy  UnhealthySet
 }
 
 func NewVersionedRouter(maxHistory int) *VersionedRouter {
 	return &VersionedRouter{
-		tables:     make(map[uint64]*Table),
+		tables:     make(map[uint64]Balancer),
+		states:     make(map[string]backendState),
 		maxHistory: maxHistory,
 	}
 }
 
-func (vr *VersionedRouter) AddGeneration(gen uint64, table *Table) {
-	vr.mu.Lock()
-	defer vr.mu.Unlock()
+// AddGeneration makes table the current generation. It returns the
+// slot diff against the previous current table, or nil when there is
+// none or the tables are not comparable Maglev tables.
+func (vr *VersionedRouter) AddGeneration(gen uint64, table Balancer) *DiffReport {
+	for {
+		vr.mu.RLock()
+		_, exists := vr.tables[gen]
+		prevGen := vr.currentGen
+		prev := vr.tables[prevGen]
+		vr.mu.RUnlock()
+
+		if exists {
+			return nil
+		}
 
-	if _, exists := vr.tables[gen]; exists {
-		return
+		// Diff scans every slot, so run it without blocking Route
+		var report *DiffReport
+		prevTable, prevOK := prev.(*Table)
+		next, nextOK := table.(*Table)
+		if prevOK && nextOK {
+			report, _ = Diff(prevTable, next)
+		}
+
+		vr.mu.Lock()
+		// Retry if another generation was added in the meantime
+		if vr.currentGen != prevGen {
+			vr.mu.Unlock()
+			continue
+		}
+		vr.addGeneration(gen, table)
+		vr.mu.Unlock()
+		return report
 	}
+}
 
+// addGeneration stores table as the current generation, evicting the
+// oldest beyond maxHistory. vr.mu must be held for writing.
+func (vr *VersionedRouter) addGeneration(gen uint64, table Balancer) {
 	vr.tables[gen] = table
 	vr.order = append(vr.order, gen)
 	vr.currentGen = gen
@@ -46,6 +86,29 @@ func (vr *VersionedRouter) AddGeneration(gen uint64, table *Table) {
 	}
 }
 
+// SetLoadTracker enables bounded-load routing against the given tracker.
+// Passing nil disables it.
+func (vr *VersionedRouter) SetLoadTracker(lt *LoadTracker) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	vr.loads = lt
+}
+
+// SetGuaranteeReplicas makes Route relax domain isolation, in slot
+// order, whenever isolated peers cannot fill the replication count.
+func (vr *VersionedRouter) SetGuaranteeReplicas(enabled bool) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	vr.guarantee = enabled
+}
+
+// LoadTracker returns the tracker used for bounded-load routing, if any
+func (vr *VersionedRouter) LoadTracker() *LoadTracker {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	return vr.loads
+}
+
 type RouteResult struct {
 	Backend          Backend   // current primary
 	Peers            []Backend // current generation peers
@@ -54,17 +117,72 @@ type RouteResult struct {
 	Generation       uint64    // current generation
 	ClientGeneration *uint64   // parsed client generation (nil if absent/invalid)
 	RequiresRecovery bool      // client is stale and backend changed
+	Owner            *Backend  // Maglev primary, if Backend differs from it
+	Spilled          bool      // Backend is a bounded-load spill target
+	UnderReplicated  bool      // fewer backends than the replication count
+	IsolationRelaxed bool      // some peers share a failure domain
+	TemporaryOwner   bool      // Backend stands in for an unavailable Owner
 }
 
 func (vr *VersionedRouter) Route(key string, clientGenHeader string, replicationCount, maxJumps int) RouteResult {
 	vr.mu.RLock()
 	defer vr.mu.RUnlock()
 
+	result, relaxed := vr.route(key, clientGenHeader, replicationCount, maxJumps)
+	result.IsolationRelaxed = relaxed
+	if len(vr.states) > 0 || vr.unhealthy.Len() > 0 {
+		vr.skipUnavailable(&result, key, replicationCount, maxJumps)
+	}
+	result.UnderReplicated = 1+len(result.Peers) < replicationCount
+	if vr.loads != nil {
+		vr.spill(&result, key)
+	}
+	return result
+}
+
+// spill moves the result to the bounded-load backend if the primary is
+// over capacity. The primary stays first among the peers as the owner.
+func (vr *VersionedRouter) spill(result *RouteResult, key string) {
+	// Keep results already moved off an unavailable owner
+	if result.Owner != nil {
+		return
+	}
+
+	target := LookupBounded(vr.tables[vr.currentGen], key, vr.loads)
+	if target.ID == result.Backend.ID || !vr.available(target.ID, result.ClientGeneration != nil, time.Now()) {
+		return
+	}
+
+	owner := result.Backend
+	peers := []Backend{owner}
+	for _, peer := range result.Peers {
+		if peer.ID != target.ID {
+			peers = append(peers, peer)
+		}
+	}
+
+	result.Owner = &owner
+	result.Backend = target
+	result.Peers = peers
+	result.Spilled = true
+}
+
+// lookup returns the primary and peers for key, guaranteeing the
+// replica count if the router is configured to. Backends for which a
+// non-nil skip returns true are passed over.
+func (vr *VersionedRouter) lookup(table Balancer, key string, replicationCount, maxJumps int, skip func(Backend) bool) ([]Backend, bool) {
+	if vr.guarantee {
+		return lookupNGuaranteed(table, key, replicationCount, maxJumps, skip)
+	}
+	return lookupNIsolated(table, key, replicationCount, maxJumps, skip), false
+}
+
+func (vr *VersionedRouter) route(key string, clientGenHeader string, replicationCount, maxJumps int) (RouteResult, bool) {
 	currentGen := vr.currentGen
 	currentTable := vr.tables[currentGen]
 
 	// Compute current peers and primary
-	newPeers := currentTable.LookupNWithDomainIsolation(key, replicationCount, maxJumps)
+	newPeers, relaxed := vr.lookup(currentTable, key, replicationCount, maxJumps, nil)
 	var newPrimary Backend
 	if len(newPeers) > 0 {
 		newPrimary = newPeers[0]
@@ -78,7 +196,7 @@ func (vr *VersionedRouter) Route(key string, clientGenHeader string, replication
 			Peers:            newPeers,
 			Generation:       currentGen,
 			ClientGeneration: nil,
-		}
+		}, relaxed
 	}
 
 	// Parse client generation
@@ -90,12 +208,12 @@ func (vr *VersionedRouter) Route(key string, clientGenHeader string, replication
 			Peers:            newPeers,
 			Generation:       currentGen,
 			ClientGeneration: nil,
-		}
+		}, relaxed
 	}
 
 	// Compare backends across generations
 	clientTable := vr.tables[clientGen]
-	oldPeers := clientTable.LookupNWithDomainIsolation(key, replicationCount, maxJumps)
+	oldPeers, _ := vr.lookup(clientTable, key, replicationCount, maxJumps, nil)
 	var oldPrimary Backend
 	if len(oldPeers) > 0 {
 		oldPrimary = oldPeers[0]
@@ -112,7 +230,7 @@ func (vr *VersionedRouter) Route(key string, clientGenHeader string, replication
 			Generation:       currentGen,
 			ClientGeneration: &clientGen,
 			RequiresRecovery: true,
-		}
+		}, relaxed
 	}
 
 	// Backend didn't change, just re-sync peers
@@ -121,5 +239,5 @@ func (vr *VersionedRouter) Route(key string, clientGenHeader string, replication
 		Peers:            newPeers,
 		Generation:       currentGen,
 		ClientGeneration: &clientGen,
-	}
+	}, relaxed
 }
@@ -0,0 +1,104 @@
+package maglev
+
+import (
+	"fmt"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/spaolacci/murmur3"
+)
+
+// HashAlgorithm identifies a built-in string hash function
+type HashAlgorithm uint8
+
+const (
+	HashFNV1a    HashAlgorithm = iota // 32-bit FNV-1a
+	HashXXHash64                      // 64-bit xxHash
+	HashMurmur3                       // 64-bit MurmurHash3 (x64_128, low half)
+)
+
+// Hasher selects the hash used for lookup keys and the hashes used
+// to derive each backend's offset and skip in the permutation.
+type Hasher struct {
+	Key    HashAlgorithm
+	Offset HashAlgorithm
+	Skip   HashAlgorithm
+}
+
+// DefaultHasher uses FNV-1a throughout, matching tables built before hashers were configurable
+var DefaultHasher = Hasher{Key: HashFNV1a, Offset: HashFNV1a, Skip: HashFNV1a}
+
+func (a HashAlgorithm) String() string {
+	switch a {
+	case HashFNV1a:
+		return "fnv1a"
+	case HashXXHash64:
+		return "xxhash64"
+	case HashMurmur3:
+		return "murmur3"
+	default:
+		return fmt.Sprintf("HashAlgorithm(%d)", uint8(a))
+	}
+}
+
+// Sum hashes s with the algorithm
+func (a HashAlgorithm) Sum(s string) uint64 {
+	switch a {
+	case HashXXHash64:
+		return xxhash.Sum64String(s)
+	case HashMurmur3:
+		return murmur3.Sum64([]byte(s))
+	default:
+		return uint64(hash32(s))
+	}
+}
+
+// SumBytes hashes b with the algorithm; it equals Sum(string(b))
+func (a HashAlgorithm) SumBytes(b []byte) uint64 {
+	switch a {
+	case HashXXHash64:
+		return xxhash.Sum64(b)
+	case HashMurmur3:
+		return murmur3.Sum64(b)
+	default:
+		return uint64(hash32(b))
+	}
+}
+
+// Mix64 is the splitmix64 finalizer. It derives well-spread scores
+// from combined hashes, e.g. for highest random weight rankings.
+func Mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (a HashAlgorithm) valid() bool {
+	return a <= HashMurmur3
+}
+
+func (h Hasher) validate() error {
+	for _, a := range []HashAlgorithm{h.Key, h.Offset, h.Skip} {
+		if !a.valid() {
+			return fmt.Errorf("unknown hash algorithm: %s", a)
+		}
+	}
+	return nil
+}
+
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// Simple FNV-1a hash, inlined to avoid allocating a hash.Hash32
+func hash32[T string | []byte](s T) uint32 {
+	h := uint32(fnvOffset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= fnvPrime32
+	}
+	return h
+}
@@ -0,0 +1,68 @@
+package maglev
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+var hashAlgorithms = []HashAlgorithm{HashFNV1a, HashXXHash64, HashMurmur3}
+
+func TestHashAlgorithmSumBytesMatchesSum(t *testing.T) {
+	for _, a := range hashAlgorithms {
+		for _, s := range []string{"", "a", "room-1", "10.0.0.1#"} {
+			if got, want := a.SumBytes([]byte(s)), a.Sum(s); got != want {
+				t.Errorf("%s: SumBytes(%q) = %d, Sum = %d", a, s, got, want)
+			}
+		}
+	}
+}
+
+func TestBuildRejectsUnknownHashAlgorithm(t *testing.T) {
+	_, err := Build([]Backend{{ID: "a"}}, 1009, WithHasher(Hasher{Key: HashMurmur3 + 1}))
+	if err == nil {
+		t.Fatal("Build succeeded with an unknown hash algorithm")
+	}
+}
+
+// TestHasherDistribution routes short sequential room IDs, the worst
+// case for FNV-1a, and compares how evenly each hasher spreads them.
+func TestHasherDistribution(t *testing.T) {
+	const (
+		numBackends = 20
+		numKeys     = 100000
+	)
+
+	backends := make([]Backend, numBackends)
+	for i := range backends {
+		backends[i] = Backend{ID: fmt.Sprintf("10.0.0.%d", i+1)}
+	}
+
+	for _, a := range hashAlgorithms {
+		t.Run(a.String(), func(t *testing.T) {
+			table, err := Build(backends, DefaultTableSize, WithHasher(Hasher{Key: a, Offset: a, Skip: a}))
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			counts := make(map[string]int)
+			for i := range numKeys {
+				counts[table.Lookup(fmt.Sprintf("room-%d", i)).ID]++
+			}
+
+			// Coefficient of variation of keys per backend
+			mean := float64(numKeys) / numBackends
+			var variance float64
+			for _, b := range backends {
+				d := float64(counts[b.ID]) - mean
+				variance += d * d
+			}
+			cv := math.Sqrt(variance/numBackends) / mean
+			t.Logf("%s: keys per backend cv = %.4f", a, cv)
+
+			if cv > 0.05 {
+				t.Errorf("%s: keys per backend cv = %.4f, want <= 0.05", a, cv)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package maglev
+
+import (
+	"math"
+	"sync"
+)
+
+// LoadTracker counts in-flight requests per backend for bounded-load lookups.
+// A nil *LoadTracker is valid and tracks nothing.
+type LoadTracker struct {
+	mu       sync.Mutex
+	inflight map[string]int64 // backend ID -> in-flight requests
+	total    int64
+	epsilon  float64
+}
+
+// NewLoadTracker returns a tracker that caps each backend at
+// (1+epsilon) times its weighted share of the in-flight requests.
+func NewLoadTracker(epsilon float64) *LoadTracker {
+	return &LoadTracker{
+		inflight: make(map[string]int64),
+		epsilon:  max(epsilon, 0),
+	}
+}
+
+// Acquire records the start of a request to the backend
+func (lt *LoadTracker) Acquire(id string) {
+	if lt == nil {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.inflight[id]++
+	lt.total++
+}
+
+// Release records the end of a request to the backend
+func (lt *LoadTracker) Release(id string) {
+	if lt == nil {
+		return
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	if lt.inflight[id] <= 0 {
+		return
+	}
+	lt.inflight[id]--
+	lt.total--
+	if lt.inflight[id] == 0 {
+		delete(lt.inflight, id)
+	}
+}
+
+// Load returns the in-flight request count of the backend
+func (lt *LoadTracker) Load(id string) int64 {
+	if lt == nil {
+		return 0
+	}
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	return lt.inflight[id]
+}
+
+// LookupBounded implements consistent hashing with bounded loads: it
+// scans forward from the key's slot and returns the first backend whose
+// in-flight count is below ceil((1+ε) × its weighted share of load+1).
+// With a nil tracker it behaves like Lookup.
+func (t *Table) LookupBounded(key string, loads *LoadTracker) Backend {
+	if loads == nil {
+		return t.Lookup(key)
+	}
+
+	loads.mu.Lock()
+	defer loads.mu.Unlock()
+
+	// Count the request being placed so capacity is never zero
+	demand := (1 + loads.epsilon) * float64(loads.total+1)
+
+	seen := make(map[int]struct{})
+	start := t.slotFor(key)
+	for i := 0; len(seen) < len(t.backends)-len(t.standby) && i < t.m; i++ {
+		backendIndex := t.slots.at((start + i) % t.m)
+		if _, ok := seen[backendIndex]; ok {
+			continue
+		}
+		seen[backendIndex] = struct{}{}
+
+		backend := t.backends[backendIndex]
+		share := float64(t.weights[backendIndex]) / float64(t.totalWeight)
+		capacity := int64(math.Ceil(demand * share))
+		if loads.inflight[backend.ID] < capacity {
+			return backend
+		}
+	}
+
+	// Every backend is at capacity; fall back to the plain owner
+	return t.backends[t.slots.at(start)]
+}
@@ -0,0 +1,146 @@
+package maglev
+
+// Allocation-free lookups for hot paths. The Append* variants take a
+// []byte key and append to a caller-supplied slice, so they do not
+// allocate when dst has enough capacity and the table holds at most
+// 64*inlineBitsetWords backends and failure domains.
+
+// inlineBitsetWords sizes the stack-allocated dedup sets (1024 entries)
+const inlineBitsetWords = 16
+
+// bitset is a set of small non-negative integers
+type bitset []uint64
+
+// newBitset returns a bitset for n entries, backed by buf when it fits
+func newBitset(buf []uint64, n int) bitset {
+	words := (n + 63) / 64
+	if words <= len(buf) {
+		return buf[:words]
+	}
+	return make(bitset, words)
+}
+
+func (b bitset) has(i int) bool {
+	return b[i>>6]&(1<<(uint(i)&63)) != 0
+}
+
+func (b bitset) set(i int) {
+	b[i>>6] |= 1 << (uint(i) & 63)
+}
+
+// LookupBytes returns the backend for a given key
+func (t *Table) LookupBytes(key []byte) Backend {
+	return t.backends[t.slots.at(int(t.hasher.Key.SumBytes(key)%uint64(t.m)))]
+}
+
+// AppendLookupN appends up to `n` unique backends for the key to dst,
+// in the same order as LookupN.
+func (t *Table) AppendLookupN(dst []Backend, key []byte, n int) []Backend {
+	if n <= 0 {
+		return dst
+	}
+	return t.appendLookupN(dst, t.hasher.Key.SumBytes(key), n)
+}
+
+// AppendLookupNWithDomainIsolation appends up to `count` backends from
+// distinct failure domains to dst, in the same order as
+// LookupNWithDomainIsolation.
+func (t *Table) AppendLookupNWithDomainIsolation(dst []Backend, key []byte, count, maxJumps int) []Backend {
+	if count <= 0 || maxJumps <= 0 || t.m == 0 {
+		return dst
+	}
+
+	var backendBuf, domainBuf [inlineBitsetWords]uint64
+	seenBackends := newBitset(backendBuf[:], len(t.backends))
+	seenDomains := newBitset(domainBuf[:], t.numDomains)
+	return t.appendIsolated(dst, t.hasher.Key.SumBytes(key), count, maxJumps, seenBackends, seenDomains)
+}
+
+func (t *Table) appendLookupN(dst []Backend, keyHash uint64, n int) []Backend {
+	var backendBuf [inlineBitsetWords]uint64
+	seenBackends := newBitset(backendBuf[:], len(t.backends))
+
+	want := len(dst) + n
+	dst = t.appendSlotOwners(dst, keyHash, want, seenBackends)
+	return t.appendStandby(dst, keyHash, want, seenBackends, nil)
+}
+
+// appendIsolated scans up to maxJumps slots from the key's slot and
+// appends backends not yet seen from failure domains not yet seen,
+// followed by zero-weight backends if any slot owner was selected.
+func (t *Table) appendIsolated(dst []Backend, keyHash uint64, count, maxJumps int, seenBackends, seenDomains bitset) []Backend {
+	want := len(dst) + count
+	found := len(dst)
+	start := int(keyHash % uint64(t.m))
+
+	for i := 0; len(dst) < want && i < maxJumps; i++ {
+		backendIdx := t.slots.at((start + i) % t.m)
+
+		// Skip if already selected or same domain already chosen
+		if seenBackends.has(backendIdx) || seenDomains.has(t.domains[backendIdx]) {
+			continue
+		}
+
+		dst = append(dst, t.backends[backendIdx])
+		seenBackends.set(backendIdx)
+		seenDomains.set(t.domains[backendIdx])
+	}
+
+	// Never promote a zero-weight backend to primary
+	if len(dst) == found {
+		return dst
+	}
+	return t.appendStandby(dst, keyHash, want, seenBackends, seenDomains)
+}
+
+// appendSlotOwners scans the whole table from the key's slot and
+// appends unseen backends until dst holds `want` entries.
+func (t *Table) appendSlotOwners(dst []Backend, keyHash uint64, want int, seenBackends bitset) []Backend {
+	owners := len(t.backends) - len(t.standby)
+	start := int(keyHash % uint64(t.m))
+
+	for i := 0; len(dst) < want && i < t.m; i++ {
+		backendIdx := t.slots.at((start + i) % t.m)
+		if seenBackends.has(backendIdx) {
+			continue
+		}
+		dst = append(dst, t.backends[backendIdx])
+		seenBackends.set(backendIdx)
+
+		if owners--; owners == 0 {
+			break
+		}
+	}
+	return dst
+}
+
+// appendStandby appends zero-weight backends, ranked for the key by
+// highest random weight, until dst holds `want` entries. A nil
+// seenDomains disables failure domain isolation.
+func (t *Table) appendStandby(dst []Backend, keyHash uint64, want int, seenBackends, seenDomains bitset) []Backend {
+	for len(dst) < want {
+		best := -1
+		var bestScore uint64
+		for _, backendIdx := range t.standby {
+			if seenBackends.has(backendIdx) {
+				continue
+			}
+			if seenDomains != nil && seenDomains.has(t.domains[backendIdx]) {
+				continue
+			}
+			if score := Mix64(keyHash ^ t.idHashes[backendIdx]); best < 0 || score > bestScore {
+				best, bestScore = backendIdx, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		dst = append(dst, t.backends[best])
+		seenBackends.set(best)
+		if seenDomains != nil {
+			seenDomains.set(t.domains[best])
+		}
+	}
+	return dst
+}
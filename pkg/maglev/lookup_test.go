@@ -0,0 +1,129 @@
+package maglev
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func testKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = fmt.Appendf(nil, "room-%d", i)
+	}
+	return keys
+}
+
+func TestAppendLookupsMatchLookups(t *testing.T) {
+	table, err := Build(testBackends(30), 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	for _, key := range testKeys(200) {
+		if got, want := table.LookupBytes(key), table.Lookup(string(key)); got != want {
+			t.Fatalf("LookupBytes(%q) = %v, want %v", key, got, want)
+		}
+		if got, want := table.AppendLookupN(nil, key, 5), table.LookupN(string(key), 5); !slices.Equal(got, want) {
+			t.Fatalf("AppendLookupN(%q) = %v, want %v", key, got, want)
+		}
+		got := table.AppendLookupNWithDomainIsolation(nil, key, 3, 20)
+		want := table.LookupNWithDomainIsolation(string(key), 3, 20)
+		if !slices.Equal(got, want) {
+			t.Fatalf("AppendLookupNWithDomainIsolation(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestAppendLookupsDoNotAllocate(t *testing.T) {
+	keys := testKeys(64)
+	for _, a := range hashAlgorithms {
+		table, err := Build(testBackends(30), 1009, WithHasher(Hasher{Key: a, Offset: a, Skip: a}))
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+
+		dst := make([]Backend, 0, 8)
+		lookups := map[string]func(key []byte){
+			"LookupBytes":   func(key []byte) { table.LookupBytes(key) },
+			"AppendLookupN": func(key []byte) { dst = table.AppendLookupN(dst[:0], key, 5) },
+			"AppendLookupNWithDomainIsolation": func(key []byte) {
+				dst = table.AppendLookupNWithDomainIsolation(dst[:0], key, 3, 20)
+			},
+		}
+		for name, lookup := range lookups {
+			i := 0
+			allocs := testing.AllocsPerRun(100, func() {
+				lookup(keys[i%len(keys)])
+				i++
+			})
+			if allocs != 0 {
+				t.Errorf("%s with %s: %v allocs per lookup, want 0", name, a, allocs)
+			}
+		}
+	}
+}
+
+func benchmarkTable(b *testing.B, numBackends int) *Table {
+	table, err := Build(testBackends(numBackends), DefaultTableSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return table
+}
+
+func BenchmarkLookup(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		table.Lookup(string(keys[i%len(keys)]))
+	}
+}
+
+func BenchmarkLookupBytes(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		table.LookupBytes(keys[i%len(keys)])
+	}
+}
+
+func BenchmarkLookupN(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		table.LookupN(string(keys[i%len(keys)]), 3)
+	}
+}
+
+func BenchmarkAppendLookupN(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	dst := make([]Backend, 0, 3)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		dst = table.AppendLookupN(dst[:0], keys[i%len(keys)], 3)
+	}
+}
+
+func BenchmarkLookupNWithDomainIsolation(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		table.LookupNWithDomainIsolation(string(keys[i%len(keys)]), 3, 20)
+	}
+}
+
+func BenchmarkAppendLookupNWithDomainIsolation(b *testing.B) {
+	table := benchmarkTable(b, 100)
+	keys := testKeys(1024)
+	dst := make([]Backend, 0, 3)
+	b.ReportAllocs()
+	for i := 0; b.Loop(); i++ {
+		dst = table.AppendLookupNWithDomainIsolation(dst[:0], keys[i%len(keys)], 3, 20)
+	}
+}
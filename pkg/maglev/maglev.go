@@ -1,20 +1,42 @@
 package maglev
 
 import (
+	"cmp"
 	"errors"
-	"hash/fnv"
+	"net"
+	"slices"
 	"strings"
+	"sync"
 )
 
 type Backend struct {
 	ID            string // Unique identifier (e.g., Pod IP or name)
-	FailureDomain string // Unique identifier for failure domain of the backend
+	FailureDomain string // Unique identifier for failure domain of the backend (levels joined by "/")
+	Weight        uint32 // Relative share of slots; 0 means peer-only (never primary)
+	Address       string // host:port to connect to, if it differs per backend (e.g., from SRV records)
+}
+
+// Addr returns the backend's Address, or its ID on defaultPort if unset
+func (b Backend) Addr(defaultPort string) string {
+	if b.Address != "" {
+		return b.Address
+	}
+	return net.JoinHostPort(strings.TrimSpace(b.ID), defaultPort)
 }
 
 type Table struct {
-	slots    []int // slot index -> backend index
+	slots    slotArray // slot index -> backend index
 	backends []Backend
-	m        int // table size
+	standby  []int // indices of zero-weight backends, which own no slots
+	m        int   // table size
+	hasher   Hasher
+
+	weights     []uint64 // effective weight per backend
+	totalWeight uint64
+
+	domains    []int    // backend index -> failure domain index
+	numDomains int      // distinct failure domains
+	idHashes   []uint64 // backend index -> key hash of its ID
 }
 
 func (t Table) String() string {
@@ -25,41 +47,182 @@ func (t Table) String() string {
 	return strings.Join(ids, ",")
 }
 
-// Prime number recommended, e.g., 65537
+// Table sizes must be prime, e.g., 65537 (see SuggestTableSize)
 const DefaultTableSize = 65537
 
-// Build creates a Maglev lookup table for the given backends
-func Build(backends []Backend, tableSize int) (*Table, error) {
+// Build creates a Maglev lookup table for the given backends.
+// tableSize must be prime.
+// Slots are assigned in proportion to Backend.Weight. If no backend
+// has a positive weight, all backends are weighted equally.
+// Backends are sorted first, so equal sets in any order yield identical tables.
+func Build(backends []Backend, tableSize int, opts ...Option) (*Table, error) {
 	numBackends := len(backends)
 	if numBackends == 0 || tableSize <= 0 {
 		return nil, errors.New("invalid inputs")
 	}
 
-	offsets := make([]int, numBackends)
-	skips := make([]int, numBackends)
-	table := make([]int, tableSize)
-	for i := range table {
-		table[i] = -1
+	if err := validateTableSize(tableSize); err != nil {
+		return nil, err
 	}
 
-	// Compute offset and skip for each backend
-	for i, b := range backends {
-		h := hash32(b.ID)
-		offsets[i] = int(h % uint32(tableSize))
+	cfg := newBuildConfig(opts)
+	if err := cfg.hasher.validate(); err != nil {
+		return nil, err
+	}
+
+	backends = canonicalize(backends)
+	perms := make([]permutation, numBackends)
+	parallelFor(numBackends, cfg.workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			perms[i] = newPermutation(backends[i].ID, tableSize, cfg.hasher)
+		}
+	})
+
+	return populate(backends, perms, tableSize, cfg.hasher, cfg.workers), nil
+}
 
+// canonicalize returns a sorted copy of backends
+func canonicalize(backends []Backend) []Backend {
+	sorted := slices.Clone(backends)
+	slices.SortFunc(sorted, func(a, b Backend) int {
+		return cmp.Or(
+			cmp.Compare(a.ID, b.ID),
+			cmp.Compare(a.FailureDomain, b.FailureDomain),
+			cmp.Compare(a.Weight, b.Weight),
+			cmp.Compare(a.Address, b.Address),
+		)
+	})
+	return sorted
+}
+
+// permutation holds a backend's offset and skip into the table
+type permutation struct {
+	offset int
+	skip   int
+}
+
+func newPermutation(id string, tableSize int, h Hasher) permutation {
+	return permutation{
+		offset: int(h.Offset.Sum(id) % uint64(tableSize)),
 		// skips must be coprime to tableSize
 		// ([0, tableSize-1]) is coprime since tableSize is prime
-		skips[i] = int((hash32(b.ID+"#") % uint32(tableSize-1)) + 1)
+		skip: int((h.Skip.Sum(id+"#") % uint64(tableSize-1)) + 1),
+	}
+}
+
+// populate fills a table of tableSize slots from per-backend permutations
+func populate(backends []Backend, perms []permutation, tableSize int, h Hasher, workers int) *Table {
+	weights, maxWeight := effectiveWeights(backends)
+
+	table := make([]int, tableSize)
+	parallelFor(tableSize, workers, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			table[i] = -1
+		}
+	})
+
+	if workers > 1 {
+		fillParallel(table, perms, weights, maxWeight, workers)
+	} else {
+		fill(table, perms, weights, maxWeight)
 	}
 
-	// Fill the table using Maglev permutation
+	return newTable(backends, table, h, workers)
+}
+
+// fill populates table using weighted Maglev permutation:
+// each round a backend earns its weight in credit and claims
+// its next preferred slot once the credit reaches maxWeight.
+func fill(table []int, perms []permutation, weights []uint64, maxWeight uint64) {
+	tableSize := len(table)
+	posForBackends := make([]int, len(perms))
+	credits := make([]uint64, len(perms))
+	for filled := 0; filled < tableSize; {
+		for i := range perms {
+			credits[i] += weights[i]
+			if credits[i] < maxWeight {
+				continue
+			}
+			credits[i] -= maxWeight
+
+			p := perms[i]
+			c := (p.offset + posForBackends[i]*p.skip) % tableSize
+			for table[c] != -1 {
+				posForBackends[i]++
+				c = (p.offset + posForBackends[i]*p.skip) % tableSize
+			}
+			table[c] = i
+			posForBackends[i]++
+			filled++
+			if filled >= tableSize {
+				break
+			}
+		}
+	}
+}
+
+// fillParallel produces the same table as fill. Each round, workers
+// advance every claiming backend past the slots already filled when
+// the round started; slots only ever fill up, so the sequential claim
+// pass can resume probing from there and only re-probes on collisions
+// within the round.
+func fillParallel(table []int, perms []permutation, weights []uint64, maxWeight uint64, workers int) {
+	tableSize := len(table)
+	numBackends := len(perms)
 	posForBackends := make([]int, numBackends)
+	credits := make([]uint64, numBackends)
+	claims := make([]bool, numBackends)
+
+	var done sync.WaitGroup
+	var rounds []chan struct{}
+	defer func() {
+		for _, round := range rounds {
+			close(round)
+		}
+	}()
+
+	chunk := (numBackends + workers - 1) / workers
+	for lo := 0; lo < numBackends; lo += chunk {
+		hi := min(lo+chunk, numBackends)
+		round := make(chan struct{})
+		rounds = append(rounds, round)
+		go func() {
+			for range round {
+				for i := lo; i < hi; i++ {
+					credits[i] += weights[i]
+					claims[i] = credits[i] >= maxWeight
+					if !claims[i] {
+						continue
+					}
+					credits[i] -= maxWeight
+
+					p := perms[i]
+					for table[(p.offset+posForBackends[i]*p.skip)%tableSize] != -1 {
+						posForBackends[i]++
+					}
+				}
+				done.Done()
+			}
+		}()
+	}
+
 	for filled := 0; filled < tableSize; {
+		done.Add(len(rounds))
+		for _, round := range rounds {
+			round <- struct{}{}
+		}
+		done.Wait()
+
 		for i := range numBackends {
-			c := (offsets[i] + posForBackends[i]*skips[i]) % tableSize
+			if !claims[i] {
+				continue
+			}
+
+			p := perms[i]
+			c := (p.offset + posForBackends[i]*p.skip) % tableSize
 			for table[c] != -1 {
 				posForBackends[i]++
-				c = (offsets[i] + posForBackends[i]*skips[i]) % tableSize
+				c = (p.offset + posForBackends[i]*p.skip) % tableSize
 			}
 			table[c] = i
 			posForBackends[i]++
@@ -69,89 +232,167 @@ func Build(backends []Backend, tableSize int) (*Table, error) {
 			}
 		}
 	}
+}
+
+// newTable wraps filled slots into a Table with its lookup metadata
+func newTable(backends []Backend, slots []int, h Hasher, workers int) *Table {
+	numBackends := len(backends)
+	weights, _ := effectiveWeights(backends)
+
+	var standby []int
+	var totalWeight uint64
+	for i, w := range weights {
+		if w == 0 {
+			standby = append(standby, i)
+		}
+		totalWeight += w
+	}
+
+	// Precompute per-backend data used by lookups
+	domains := make([]int, numBackends)
+	domainIndex := make(map[string]int)
+	idHashes := make([]uint64, numBackends)
+	for i, b := range backends {
+		idx, ok := domainIndex[b.FailureDomain]
+		if !ok {
+			idx = len(domainIndex)
+			domainIndex[b.FailureDomain] = idx
+		}
+		domains[i] = idx
+		idHashes[i] = h.Key.Sum(b.ID)
+	}
 
 	return &Table{
-		slots:    table,
-		backends: backends,
-		m:        tableSize,
-	}, nil
+		slots:       newSlotArray(slots, numBackends, workers),
+		backends:    backends,
+		standby:     standby,
+		m:           len(slots),
+		hasher:      h,
+		weights:     weights,
+		totalWeight: totalWeight,
+		domains:     domains,
+		numDomains:  len(domainIndex),
+		idHashes:    idHashes,
+	}
+}
+
+// effectiveWeights returns per-backend weights and their maximum,
+// falling back to equal weights when none is positive.
+func effectiveWeights(backends []Backend) ([]uint64, uint64) {
+	weights := make([]uint64, len(backends))
+	var maxWeight uint64
+	for i, b := range backends {
+		weights[i] = uint64(b.Weight)
+		maxWeight = max(maxWeight, weights[i])
+	}
+	if maxWeight == 0 {
+		for i := range weights {
+			weights[i] = 1
+		}
+		maxWeight = 1
+	}
+	return weights, maxWeight
 }
 
 // Lookup returns the backend for a given key
 func (t *Table) Lookup(key string) Backend {
-	idx := int(hash32(key) % uint32(t.m))
-	backendIndex := t.slots[idx]
+	idx := t.slotFor(key)
+	backendIndex := t.slots.at(idx)
 	return t.backends[backendIndex]
 }
 
 // LookupN returns up to `n` unique backends for the given key,
 // scanning forward from the hash index in the lookup table.
+// Zero-weight backends are only used once slot owners are exhausted.
 func (t *Table) LookupN(key string, n int) []Backend {
 	if n <= 0 {
 		return nil
 	}
-
-	seen := make(map[int]struct{})
-	result := make([]Backend, 0, n)
-	start := int(hash32(key) % uint32(t.m))
-
-	// Linear scan through slots starting at hashed offset
-	for i := 0; len(result) < n && i < t.m; i++ {
-		slot := (start + i) % t.m
-		backendIndex := t.slots[slot]
-
-		if _, ok := seen[backendIndex]; !ok {
-			seen[backendIndex] = struct{}{}
-			result = append(result, t.backends[backendIndex])
-		}
-	}
-
-	return result
+	return t.appendLookupN(make([]Backend, 0, n), t.hasher.Key.Sum(key), n)
 }
 
 // LookupNWithDomainIsolation returns up to `count` distinct backends
 // from different failure domains, bounded by `maxJumps` scan attempts.
+// Zero-weight backends are considered after the scan as peers only.
 func (t *Table) LookupNWithDomainIsolation(key string, count, maxJumps int) []Backend {
 	if count <= 0 || maxJumps <= 0 || t.m == 0 {
 		return nil
 	}
 
-	result := make([]Backend, 0, count)
-	seenBackends := make(map[int]struct{})   // backend index
-	seenDomains := make(map[string]struct{}) // domain ID
-	start := int(hash32(key) % uint32(t.m))
+	var backendBuf, domainBuf [inlineBitsetWords]uint64
+	seenBackends := newBitset(backendBuf[:], len(t.backends))
+	seenDomains := newBitset(domainBuf[:], t.numDomains)
+	return t.appendIsolated(make([]Backend, 0, count), t.hasher.Key.Sum(key), count, maxJumps, seenBackends, seenDomains)
+}
 
-	attempts := 0
-	for i := 0; len(result) < count && attempts < maxJumps; i++ {
-		slot := (start + i) % t.m
-		backendIdx := t.slots[slot]
-		attempts++
+// LookupNWithDomainIsolationSkipping is LookupNWithDomainIsolation with
+// the backends for which skip returns true passed over while scanning,
+// as if their slots belonged to backends already selected.
+func (t *Table) LookupNWithDomainIsolationSkipping(key string, count, maxJumps int, skip func(Backend) bool) []Backend {
+	if count <= 0 || maxJumps <= 0 || t.m == 0 {
+		return nil
+	}
 
-		// Skip if already selected
-		if _, seen := seenBackends[backendIdx]; seen {
-			continue
-		}
+	var backendBuf, domainBuf [inlineBitsetWords]uint64
+	seenBackends := t.skipped(backendBuf[:], skip)
+	seenDomains := newBitset(domainBuf[:], t.numDomains)
+	return t.appendIsolated(make([]Backend, 0, count), t.hasher.Key.Sum(key), count, maxJumps, seenBackends, seenDomains)
+}
 
-		backend := t.backends[backendIdx]
-		domain := backend.FailureDomain
+// LookupNGuaranteed returns `count` distinct backends whenever the
+// table holds that many. It starts from the domain-isolated selection
+// and, if that falls short within `maxJumps`, fills the remainder by
+// scanning forward from the key's slot regardless of failure domain,
+// then from zero-weight backends. `relaxed` reports whether any backend
+// shares a failure domain with one selected before it.
+func (t *Table) LookupNGuaranteed(key string, count, maxJumps int) (result []Backend, relaxed bool) {
+	return t.lookupNGuaranteed(key, count, maxJumps, nil)
+}
 
-		if _, domainSeen := seenDomains[domain]; domainSeen {
-			continue // same domain already chosen
-		}
+func (t *Table) lookupNGuaranteed(key string, count, maxJumps int, skip func(Backend) bool) (result []Backend, relaxed bool) {
+	if count <= 0 || t.m == 0 {
+		return nil, false
+	}
+
+	keyHash := t.hasher.Key.Sum(key)
+	var backendBuf, domainBuf [inlineBitsetWords]uint64
+	seenBackends := t.skipped(backendBuf[:], skip)
+	seenDomains := newBitset(domainBuf[:], t.numDomains)
 
-		// Select backend
-		result = append(result, backend)
-		seenBackends[backendIdx] = struct{}{}
-		seenDomains[domain] = struct{}{}
+	result = make([]Backend, 0, count)
+	if maxJumps > 0 {
+		result = t.appendIsolated(result, keyHash, count, maxJumps, seenBackends, seenDomains)
 	}
+	if len(result) >= count {
+		return result, false
+	}
+
+	isolated := len(result)
+	result = t.appendSlotOwners(result, keyHash, count, seenBackends)
+	result = t.appendStandby(result, keyHash, count, seenBackends, nil)
+	return result, sharesDomain(result, isolated)
+}
+
+// skipped returns a set of the backends for which a non-nil skip
+// returns true, backed by buf when it fits
+func (t *Table) skipped(buf []uint64, skip func(Backend) bool) bitset {
+	set := newBitset(buf, len(t.backends))
+	if skip != nil {
+		for i, b := range t.backends {
+			if skip(b) {
+				set.set(i)
+			}
+		}
+	}
+	return set
+}
 
-	return result
+// Hasher returns the hash functions the table was built with
+func (t *Table) Hasher() Hasher {
+	return t.hasher
 }
 
-// Simple FNV-1a hash
-// Can be swapped with other stronger hashes such as xxHash or MurmurHash3
-func hash32(s string) uint32 {
-	h := fnv.New32a()
-	_, _ = h.Write([]byte(s))
-	return h.Sum32()
+// slotFor returns the slot index a key hashes to
+func (t *Table) slotFor(key string) int {
+	return int(t.hasher.Key.Sum(key) % uint64(t.m))
 }
@@ -0,0 +1,149 @@
+package maglev
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+)
+
+// slotCounts returns the number of slots each backend owns
+func slotCounts(table *Table) map[string]int {
+	counts := make(map[string]int)
+	for i := range table.m {
+		counts[table.backends[table.slots.at(i)].ID]++
+	}
+	return counts
+}
+
+func testBackends(n int) []Backend {
+	backends := make([]Backend, n)
+	for i := range backends {
+		backends[i] = Backend{
+			ID:            fmt.Sprintf("10.0.%d.%d", i/250, i%250+1),
+			FailureDomain: fmt.Sprintf("zone-%d", i%3),
+			Weight:        uint32(i%4 + 1),
+		}
+	}
+	return backends
+}
+
+// slotIndices returns the backend ID owning each slot
+func slotIndices(table *Table) []string {
+	ids := make([]string, table.m)
+	for i := range ids {
+		ids[i] = table.backends[table.slots.at(i)].ID
+	}
+	return ids
+}
+
+func TestBuildWeightedSlotShare(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []uint32
+	}{
+		{"equal", []uint32{1, 1, 1, 1}},
+		{"unit weights scale", []uint32{10, 10, 10}},
+		{"mixed", []uint32{1, 2, 3, 4}},
+		{"skewed", []uint32{1, 1, 1, 8}},
+		{"large fleet", []uint32{4, 4, 4, 4, 4, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backends := make([]Backend, len(tt.weights))
+			var total float64
+			for i, w := range tt.weights {
+				backends[i] = Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), Weight: w}
+				total += float64(w)
+			}
+
+			table, err := Build(backends, DefaultTableSize)
+			if err != nil {
+				t.Fatalf("Build: %v", err)
+			}
+
+			counts := slotCounts(table)
+			for _, b := range backends {
+				want := float64(b.Weight) / total
+				got := float64(counts[b.ID]) / float64(DefaultTableSize)
+				// Within 2% of the table or 10% of the expected share
+				if tolerance := max(0.02, want*0.1); math.Abs(got-want) > tolerance {
+					t.Errorf("backend %s (weight %d): share %.4f, want %.4f ± %.4f", b.ID, b.Weight, got, want, tolerance)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildZeroWeightIsPeerOnly(t *testing.T) {
+	backends := []Backend{
+		{ID: "10.0.0.1", Weight: 1},
+		{ID: "10.0.0.2", Weight: 1},
+		{ID: "10.0.0.3", Weight: 0},
+	}
+
+	table, err := Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if n := slotCounts(table)["10.0.0.3"]; n != 0 {
+		t.Fatalf("zero-weight backend owns %d slots, want 0", n)
+	}
+
+	for i := range 100 {
+		key := fmt.Sprintf("room-%d", i)
+		if got := table.Lookup(key).ID; got == "10.0.0.3" {
+			t.Fatalf("Lookup(%q) returned zero-weight backend", key)
+		}
+		peers := table.LookupN(key, 3)
+		if len(peers) != 3 || peers[2].ID != "10.0.0.3" {
+			t.Fatalf("LookupN(%q, 3) = %v, want zero-weight backend last", key, peers)
+		}
+	}
+}
+
+func TestBuildAllZeroWeightsAreEqual(t *testing.T) {
+	backends := []Backend{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	table, err := Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	counts := slotCounts(table)
+	for _, b := range backends {
+		if counts[b.ID] < 300 {
+			t.Errorf("backend %s owns %d of 1009 slots, want about a third", b.ID, counts[b.ID])
+		}
+	}
+}
+
+func TestBuildIgnoresInputOrder(t *testing.T) {
+	backends := testBackends(50)
+	want, err := Build(backends, DefaultTableSize)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range 10 {
+		shuffled := slices.Clone(backends)
+		rng.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+
+		got, err := Build(shuffled, DefaultTableSize)
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+		if !slices.Equal(slotIndices(got), slotIndices(want)) {
+			t.Fatalf("shuffle %d: table differs from the unshuffled build", i)
+		}
+		if got.String() != want.String() {
+			t.Fatalf("shuffle %d: backends %s, want %s", i, got, want)
+		}
+	}
+}
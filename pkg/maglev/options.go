@@ -0,0 +1,38 @@
+package maglev
+
+import "runtime"
+
+// Option configures how Build constructs a Table
+type Option func(*buildConfig)
+
+type buildConfig struct {
+	hasher  Hasher
+	workers int
+}
+
+func newBuildConfig(opts []Option) buildConfig {
+	cfg := buildConfig{hasher: DefaultHasher, workers: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// WithHasher sets the hash functions used for keys and permutations
+func WithHasher(h Hasher) Option {
+	return func(c *buildConfig) {
+		c.hasher = h
+	}
+}
+
+// WithParallelism builds on up to `workers` goroutines, capped at
+// GOMAXPROCS: permutations, slot probing and slot storage are computed
+// concurrently, while slot claims stay in sequential order, so the
+// table is identical to a single-threaded build. Probing synchronizes
+// once per fill round, so benchmark it on the target machine before
+// enabling it.
+func WithParallelism(workers int) Option {
+	return func(c *buildConfig) {
+		c.workers = min(max(workers, 1), runtime.GOMAXPROCS(0))
+	}
+}
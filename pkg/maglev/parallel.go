@@ -0,0 +1,26 @@
+package maglev
+
+import "sync"
+
+// parallelFor splits [0, n) into contiguous chunks and calls fn on each
+// from up to `workers` goroutines, returning once all are done.
+// With one worker, fn runs on the caller's goroutine.
+func parallelFor(n, workers int, fn func(lo, hi int)) {
+	workers = min(workers, n)
+	if workers <= 1 {
+		fn(0, n)
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunk := (n + workers - 1) / workers
+	for lo := 0; lo < n; lo += chunk {
+		hi := min(lo+chunk, n)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(lo, hi)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,60 @@
+package maglev
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestBuildWithParallelismMatchesSequential(t *testing.T) {
+	for _, numBackends := range []int{1, 7, 300} {
+		backends := testBackends(numBackends)
+		backends[0].Weight = 0 // one standby backend
+
+		want, err := Build(backends, 65537)
+		if err != nil {
+			t.Fatalf("Build: %v", err)
+		}
+
+		// populate directly, as WithParallelism caps workers at GOMAXPROCS
+		backends = canonicalize(backends)
+		perms := make([]permutation, len(backends))
+		for i := range backends {
+			perms[i] = newPermutation(backends[i].ID, 65537, DefaultHasher)
+		}
+		for _, workers := range []int{2, 3, 8} {
+			got := populate(backends, perms, 65537, DefaultHasher, workers)
+			if !slices.Equal(slotIndices(got), slotIndices(want)) {
+				t.Errorf("%d backends, %d workers: table differs from the sequential build", numBackends, workers)
+			}
+		}
+	}
+}
+
+func TestWithParallelismCapsWorkers(t *testing.T) {
+	for _, workers := range []int{-1, 0, 1, runtime.GOMAXPROCS(0) + 4} {
+		var cfg buildConfig
+		WithParallelism(workers)(&cfg)
+		if want := min(max(workers, 1), runtime.GOMAXPROCS(0)); cfg.workers != want {
+			t.Errorf("WithParallelism(%d) uses %d workers, want %d", workers, cfg.workers, want)
+		}
+	}
+}
+
+// BenchmarkBuildParallelism compares sequential and parallel builds of
+// a large table with many backends
+func BenchmarkBuildParallelism(b *testing.B) {
+	backends := testBackends(200)
+	tableSize := SuggestTableSize(len(backends), 0.0001)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				if _, err := Build(backends, tableSize, WithParallelism(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package maglev
+
+import "math"
+
+// slotArray stores each slot's backend index in the narrowest unsigned
+// integer width that fits the backend count. Exactly one slice is set.
+type slotArray struct {
+	u8  []uint8
+	u16 []uint16
+	u32 []uint32
+}
+
+// newSlotArray narrows slots, converting chunks on up to `workers` goroutines
+func newSlotArray(slots []int, numBackends, workers int) slotArray {
+	var s slotArray
+	switch indexWidth(numBackends) {
+	case 1:
+		s.u8 = make([]uint8, len(slots))
+		parallelFor(len(slots), workers, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				s.u8[i] = uint8(slots[i])
+			}
+		})
+	case 2:
+		s.u16 = make([]uint16, len(slots))
+		parallelFor(len(slots), workers, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				s.u16[i] = uint16(slots[i])
+			}
+		})
+	default:
+		s.u32 = make([]uint32, len(slots))
+		parallelFor(len(slots), workers, func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				s.u32[i] = uint32(slots[i])
+			}
+		})
+	}
+	return s
+}
+
+// at returns the backend index stored in slot i
+func (s slotArray) at(i int) int {
+	switch {
+	case s.u8 != nil:
+		return int(s.u8[i])
+	case s.u16 != nil:
+		return int(s.u16[i])
+	default:
+		return int(s.u32[i])
+	}
+}
+
+// width returns the bytes used per slot
+func (s slotArray) width() int {
+	switch {
+	case s.u8 != nil:
+		return 1
+	case s.u16 != nil:
+		return 2
+	default:
+		return 4
+	}
+}
+
+// indexWidth returns the bytes needed to store a backend index
+func indexWidth(numBackends int) int {
+	switch {
+	case numBackends <= math.MaxUint8+1:
+		return 1
+	case numBackends <= math.MaxUint16+1:
+		return 2
+	default:
+		return 4
+	}
+}
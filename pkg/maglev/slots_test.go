@@ -0,0 +1,93 @@
+package maglev
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestIndexWidth(t *testing.T) {
+	tests := []struct {
+		numBackends int
+		want        int
+	}{
+		{1, 1},
+		{math.MaxUint8 + 1, 1},
+		{math.MaxUint8 + 2, 2},
+		{math.MaxUint16 + 1, 2},
+		{math.MaxUint16 + 2, 4},
+	}
+	for _, tt := range tests {
+		if got := indexWidth(tt.numBackends); got != tt.want {
+			t.Errorf("indexWidth(%d) = %d, want %d", tt.numBackends, got, tt.want)
+		}
+	}
+}
+
+func TestSlotArrayPreservesIndices(t *testing.T) {
+	for _, numBackends := range []int{3, math.MaxUint8 + 1, math.MaxUint16 + 1, math.MaxUint16 + 2} {
+		slots := randomSlots(10007, numBackends)
+		for _, workers := range []int{1, 4} {
+			s := newSlotArray(slots, numBackends, workers)
+			if s.width() != indexWidth(numBackends) {
+				t.Fatalf("%d backends: width %d, want %d", numBackends, s.width(), indexWidth(numBackends))
+			}
+			for i, want := range slots {
+				if got := s.at(i); got != want {
+					t.Fatalf("%d backends, %d workers: slot %d = %d, want %d", numBackends, workers, i, got, want)
+				}
+			}
+		}
+	}
+}
+
+func randomSlots(tableSize, numBackends int) []int {
+	rng := rand.New(rand.NewPCG(1, 2))
+	slots := make([]int, tableSize)
+	for i := range slots {
+		slots[i] = rng.IntN(numBackends)
+	}
+	return slots
+}
+
+// BenchmarkSlotLookup compares reading a random slot from each width
+// against the []int slots tables used before narrowing.
+func BenchmarkSlotLookup(b *testing.B) {
+	const numBackends = 200
+	slots := randomSlots(DefaultTableSize*10+7, numBackends)
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	indices := make([]int, 4096)
+	for i := range indices {
+		indices[i] = rng.IntN(len(slots))
+	}
+
+	b.Run("int", func(b *testing.B) {
+		var sum int
+		for i := 0; b.Loop(); i++ {
+			sum += slots[indices[i%len(indices)]]
+		}
+		_ = sum
+	})
+
+	widths := map[string]slotArray{
+		"uint8":  {u8: make([]uint8, len(slots))},
+		"uint16": {u16: make([]uint16, len(slots))},
+		"uint32": {u32: make([]uint32, len(slots))},
+	}
+	for i, slot := range slots {
+		widths["uint8"].u8[i] = uint8(slot)
+		widths["uint16"].u16[i] = uint16(slot)
+		widths["uint32"].u32[i] = uint32(slot)
+	}
+	for _, name := range []string{"uint8", "uint16", "uint32"} {
+		s := widths[name]
+		b.Run(name, func(b *testing.B) {
+			var sum int
+			for i := 0; b.Loop(); i++ {
+				sum += s.at(indices[i%len(indices)])
+			}
+			_ = sum
+		})
+	}
+}
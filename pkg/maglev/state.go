@@ -0,0 +1,137 @@
+package maglev
+
+import (
+	"slices"
+	"time"
+)
+
+// BackendState controls whether the router sends keys to a backend
+// without rebuilding the table
+type BackendState int
+
+const (
+	StateActive   BackendState = iota // routed normally
+	StateDraining                     // only keys with a generation header, until the deadline
+	StateDisabled                     // never routed
+)
+
+func (s BackendState) String() string {
+	switch s {
+	case StateActive:
+		return "active"
+	case StateDraining:
+		return "draining"
+	case StateDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
+type backendState struct {
+	state    BackendState
+	deadline time.Time // draining only; zero means no deadline
+}
+
+// SetBackendState sets the state of the backend with the given ID.
+// A draining backend keeps serving keys that carry a generation header
+// until deadline (zero for none), after which it is treated as disabled.
+func (vr *VersionedRouter) SetBackendState(id string, state BackendState, deadline time.Time) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	if state == StateActive {
+		delete(vr.states, id)
+		return
+	}
+	vr.states[id] = backendState{state: state, deadline: deadline}
+}
+
+// BackendState returns the state of the backend with the given ID
+func (vr *VersionedRouter) BackendState(id string) BackendState {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	return vr.states[id].state
+}
+
+// SetHealthy records one source's transition of the backend with the
+// given ID to healthy or unhealthy. Route skips a backend within the
+// current generation while any source reports it unhealthy, so each
+// unhealthy report must be matched by a healthy one from its source.
+func (vr *VersionedRouter) SetHealthy(id string, healthy bool) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+
+	vr.unhealthy.Report(id, healthy)
+}
+
+// Healthy reports whether no source reports the backend with the given ID unhealthy
+func (vr *VersionedRouter) Healthy(id string) bool {
+	vr.mu.RLock()
+	defer vr.mu.RUnlock()
+	return !vr.unhealthy.Contains(id)
+}
+
+// available reports whether a backend may serve a key; session is true
+// when the key carried a valid generation header
+func (vr *VersionedRouter) available(id string, session bool, now time.Time) bool {
+	if vr.unhealthy.Contains(id) {
+		return false
+	}
+
+	s, ok := vr.states[id]
+	if !ok {
+		return true
+	}
+	switch s.state {
+	case StateDraining:
+		return session && (s.deadline.IsZero() || now.Before(s.deadline))
+	case StateDisabled:
+		return false
+	default:
+		return true
+	}
+}
+
+// skipUnavailable re-runs the current generation's lookup with
+// unavailable backends passed over, so the next backends in the table's
+// preference order replace unavailable peers. If the primary is
+// unhealthy or not accepting the key, the result moves to the next
+// available backend (the next Maglev slot's backend), keeping the
+// primary as the owner.
+func (vr *VersionedRouter) skipUnavailable(result *RouteResult, key string, replicationCount, maxJumps int) {
+	now := time.Now()
+	session := result.ClientGeneration != nil
+	unavailable := func(b Backend) bool {
+		return !vr.available(b.ID, session, now)
+	}
+
+	if !unavailable(result.Backend) && !slices.ContainsFunc(result.Peers, unavailable) {
+		return
+	}
+
+	table := vr.tables[vr.currentGen]
+	backends, relaxed := vr.lookup(table, key, replicationCount, maxJumps, unavailable)
+	if len(backends) == 0 {
+		// Every backend within maxJumps is unavailable. At most
+		// len(states)+unhealthy.Len() backends are, so one more suffices.
+		for _, candidate := range table.LookupN(key, len(vr.states)+vr.unhealthy.Len()+1) {
+			if !unavailable(candidate) {
+				backends = []Backend{candidate}
+				break
+			}
+		}
+	}
+	if len(backends) == 0 {
+		result.Peers = slices.DeleteFunc(slices.Clone(result.Peers), unavailable)
+		return
+	}
+
+	owner := result.Backend
+	result.Backend, result.Peers = backends[0], backends[1:]
+	result.IsolationRelaxed = relaxed
+	if result.Backend.ID != owner.ID {
+		result.Owner = &owner
+		result.TemporaryOwner = true
+	}
+}
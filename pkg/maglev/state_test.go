@@ -0,0 +1,161 @@
+package maglev
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newDomainRouter returns a router over n backends, each in its own
+// failure domain
+func newDomainRouter(t *testing.T, n int) *VersionedRouter {
+	t.Helper()
+	backends := make([]Backend, n)
+	for i := range backends {
+		backends[i] = Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), FailureDomain: fmt.Sprintf("zone-%d", i), Weight: 1}
+	}
+	table, err := Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	vr := NewVersionedRouter(2)
+	vr.AddGeneration(1, table)
+	return vr
+}
+
+func routedIDs(result RouteResult) []string {
+	ids := []string{result.Backend.ID}
+	for _, peer := range result.Peers {
+		ids = append(ids, peer.ID)
+	}
+	return ids
+}
+
+func TestRouteBackfillsDisabledPeer(t *testing.T) {
+	vr := newDomainRouter(t, 10)
+
+	for i := range 50 {
+		key := fmt.Sprintf("room-%d", i)
+		before := vr.Route(key, "", 3, 20)
+		disabled := before.Peers[0].ID
+		vr.SetBackendState(disabled, StateDisabled, time.Time{})
+
+		got := vr.Route(key, "", 3, 20)
+		if got.UnderReplicated || len(got.Peers) != 2 {
+			t.Fatalf("%s: %d peers, UnderReplicated %v; want a backfilled peer", key, len(got.Peers), got.UnderReplicated)
+		}
+		if got.Backend != before.Backend || got.Owner != nil || got.TemporaryOwner {
+			t.Fatalf("%s: primary moved from %s to %s", key, before.Backend.ID, got.Backend.ID)
+		}
+		if slices.Contains(routedIDs(got), disabled) {
+			t.Fatalf("%s: still routed to disabled %s: %v", key, disabled, routedIDs(got))
+		}
+		if got.Peers[0] != before.Peers[1] {
+			t.Fatalf("%s: remaining peer %s not kept in order: %v", key, before.Peers[1].ID, routedIDs(got))
+		}
+
+		vr.SetBackendState(disabled, StateActive, time.Time{})
+	}
+}
+
+func TestRouteMovesOffDisabledPrimary(t *testing.T) {
+	vr := newDomainRouter(t, 10)
+
+	before := vr.Route("room-1", "", 3, 20)
+	primary := before.Backend
+	vr.SetBackendState(primary.ID, StateDisabled, time.Time{})
+
+	got := vr.Route("room-1", "", 3, 20)
+	if !got.TemporaryOwner || got.Owner == nil || *got.Owner != primary {
+		t.Fatalf("Owner = %v, TemporaryOwner = %v; want %s as the owner", got.Owner, got.TemporaryOwner, primary.ID)
+	}
+	if got.Backend != before.Peers[0] {
+		t.Fatalf("Backend = %s, want the next backend %s", got.Backend.ID, before.Peers[0].ID)
+	}
+	if got.UnderReplicated || slices.Contains(routedIDs(got), primary.ID) {
+		t.Fatalf("routed to %v, UnderReplicated %v", routedIDs(got), got.UnderReplicated)
+	}
+}
+
+func TestRouteKeepsSessionsOnDrainingBackend(t *testing.T) {
+	vr := newDomainRouter(t, 10)
+
+	primary := vr.Route("room-1", "", 3, 20).Backend
+	vr.SetBackendState(primary.ID, StateDraining, time.Now().Add(time.Hour))
+
+	if got := vr.Route("room-1", "", 3, 20); got.Backend == primary || got.Owner == nil {
+		t.Fatalf("new session routed to draining %s", primary.ID)
+	}
+	session := vr.Route("room-1", "1", 3, 20)
+	if session.Backend != primary || session.TemporaryOwner {
+		t.Fatalf("session routed to %s, want draining %s", session.Backend.ID, primary.ID)
+	}
+
+	vr.SetBackendState(primary.ID, StateDraining, time.Now().Add(-time.Second))
+	if got := vr.Route("room-1", "1", 3, 20); got.Backend == primary {
+		t.Fatalf("session routed to %s past its drain deadline", primary.ID)
+	}
+}
+
+func TestRouteGuaranteedBackfillsDisabledPeers(t *testing.T) {
+	// Three domains hold at most three isolated backends
+	backends := make([]Backend, 6)
+	for i := range backends {
+		backends[i] = Backend{ID: fmt.Sprintf("10.0.0.%d", i+1), FailureDomain: fmt.Sprintf("zone-%d", i%3), Weight: 1}
+	}
+	table, err := Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	vr := NewVersionedRouter(2)
+	vr.AddGeneration(1, table)
+	vr.SetGuaranteeReplicas(true)
+
+	before := vr.Route("room-1", "", 4, 20)
+	vr.SetBackendState(before.Peers[0].ID, StateDisabled, time.Time{})
+	vr.SetBackendState(before.Peers[1].ID, StateDisabled, time.Time{})
+
+	got := vr.Route("room-1", "", 4, 20)
+	if got.UnderReplicated || len(got.Peers) != 3 {
+		t.Fatalf("%d peers, UnderReplicated %v; want 3 peers", len(got.Peers), got.UnderReplicated)
+	}
+	if !got.IsolationRelaxed {
+		t.Fatal("IsolationRelaxed is false with four backends in three domains")
+	}
+	for _, id := range routedIDs(got) {
+		if vr.BackendState(id) == StateDisabled {
+			t.Fatalf("routed to disabled %s: %v", id, routedIDs(got))
+		}
+	}
+}
+
+func TestRouteBackfillsUnhealthyBackends(t *testing.T) {
+	vr := newDomainRouter(t, 10)
+
+	before := vr.Route("room-1", "", 3, 20)
+	vr.SetHealthy(before.Backend.ID, false)
+	vr.SetHealthy(before.Peers[0].ID, false)
+
+	got := vr.Route("room-1", "", 3, 20)
+	if !got.TemporaryOwner || got.Owner == nil || *got.Owner != before.Backend {
+		t.Fatalf("Owner = %v, TemporaryOwner = %v; want %s as the owner", got.Owner, got.TemporaryOwner, before.Backend.ID)
+	}
+	if got.Backend != before.Peers[1] {
+		t.Fatalf("Backend = %s, want the next healthy backend %s", got.Backend.ID, before.Peers[1].ID)
+	}
+	if got.UnderReplicated || len(got.Peers) != 2 {
+		t.Fatalf("%d peers, UnderReplicated %v; want 2 backfilled peers", len(got.Peers), got.UnderReplicated)
+	}
+	for _, id := range routedIDs(got) {
+		if !vr.Healthy(id) {
+			t.Fatalf("routed to unhealthy %s: %v", id, routedIDs(got))
+		}
+	}
+
+	vr.SetHealthy(before.Backend.ID, true)
+	vr.SetHealthy(before.Peers[0].ID, true)
+	if got := vr.Route("room-1", "", 3, 20); !slices.Equal(routedIDs(got), routedIDs(before)) {
+		t.Fatalf("recovered route = %v, want %v", routedIDs(got), routedIDs(before))
+	}
+}
@@ -0,0 +1,53 @@
+package maglev
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// MinSlotsPerBackend is the table size to backend ratio the Maglev
+// paper recommends to keep slot imbalance around 1%
+const MinSlotsPerBackend = 100
+
+// validateTableSize checks that tableSize is prime, which the skip
+// calculation relies on for each permutation to cover every slot
+func validateTableSize(tableSize int) error {
+	if !isPrime(tableSize) {
+		return fmt.Errorf("table size %d is not prime; use SuggestTableSize to pick one", tableSize)
+	}
+	return nil
+}
+
+// SuggestTableSize returns the smallest prime table size of at least
+// MinSlotsPerBackend slots per backend that also keeps the expected
+// deviation from ideal disruption, roughly numBackends/tableSize,
+// within targetDisruption (e.g., 0.01 for 1%). A non-positive
+// targetDisruption applies only the per-backend minimum.
+func SuggestTableSize(numBackends int, targetDisruption float64) int {
+	numBackends = max(numBackends, 1)
+	size := numBackends * MinSlotsPerBackend
+	if targetDisruption > 0 {
+		size = max(size, int(math.Ceil(float64(numBackends)/targetDisruption)))
+	}
+	return nextPrime(size)
+}
+
+// nextPrime returns the smallest prime >= n
+func nextPrime(n int) int {
+	if n <= 2 {
+		return 2
+	}
+	if n%2 == 0 {
+		n++
+	}
+	for !isPrime(n) {
+		n += 2
+	}
+	return n
+}
+
+// isPrime reports whether n is prime; ProbablyPrime is exact below 2^64
+func isPrime(n int) bool {
+	return n > 1 && big.NewInt(int64(n)).ProbablyPrime(0)
+}
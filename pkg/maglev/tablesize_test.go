@@ -0,0 +1,48 @@
+package maglev
+
+import "testing"
+
+func TestValidateTableSize(t *testing.T) {
+	for _, size := range []int{2, 3, 1009, 5003, 65537, DefaultTableSize} {
+		if err := validateTableSize(size); err != nil {
+			t.Errorf("validateTableSize(%d) = %v, want nil", size, err)
+		}
+	}
+	// Composites, including squares and Carmichael numbers
+	for _, size := range []int{-7, 0, 1, 4, 9, 561, 1000, 65536, 65539 * 65543} {
+		if err := validateTableSize(size); err == nil {
+			t.Errorf("validateTableSize(%d) accepted a non-prime size", size)
+		}
+	}
+
+	if _, err := Build([]Backend{{ID: "a"}}, 1000); err == nil {
+		t.Error("Build accepted a composite table size")
+	}
+}
+
+func TestSuggestTableSize(t *testing.T) {
+	tests := []struct {
+		numBackends      int
+		targetDisruption float64
+		want             int
+	}{
+		{0, 0, 101},        // at least one backend
+		{1, 0, 101},        // per-backend minimum
+		{10, 0, 1009},      // per-backend minimum
+		{10, 0.1, 1009},    // target already met by the minimum
+		{10, 0.001, 10007}, // target raises the size
+		{100, 0.0001, 1000003},
+	}
+	for _, tt := range tests {
+		got := SuggestTableSize(tt.numBackends, tt.targetDisruption)
+		if got != tt.want {
+			t.Errorf("SuggestTableSize(%d, %v) = %d, want %d", tt.numBackends, tt.targetDisruption, got, tt.want)
+		}
+		if err := validateTableSize(got); err != nil {
+			t.Errorf("SuggestTableSize(%d, %v) = %d: %v", tt.numBackends, tt.targetDisruption, got, err)
+		}
+		if got < max(tt.numBackends, 1)*MinSlotsPerBackend {
+			t.Errorf("SuggestTableSize(%d, %v) = %d, below the per-backend minimum", tt.numBackends, tt.targetDisruption, got)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package maglev
+
+// UnhealthySet tracks the backends that one or more sources, such as a
+// health checker and an outlier detector, report unhealthy. Each
+// unhealthy report must be matched by a healthy one from its source.
+// The zero value is empty and ready to use; it is not safe for
+// concurrent use.
+type UnhealthySet struct {
+	sources map[string]int // backend ID → sources reporting it unhealthy
+}
+
+// Report records one source's transition of the backend with the given
+// ID to healthy or unhealthy
+func (s *UnhealthySet) Report(id string, healthy bool) {
+	if !healthy {
+		if s.sources == nil {
+			s.sources = make(map[string]int)
+		}
+		s.sources[id]++
+		return
+	}
+	if s.sources[id] <= 1 {
+		delete(s.sources, id)
+		return
+	}
+	s.sources[id]--
+}
+
+// Contains reports whether any source reports the backend with the given ID unhealthy
+func (s *UnhealthySet) Contains(id string) bool {
+	_, ok := s.sources[id]
+	return ok
+}
+
+// Len returns the number of backends reported unhealthy
+func (s *UnhealthySet) Len() int {
+	return len(s.sources)
+}
@@ -0,0 +1,29 @@
+package maglev
+
+import "testing"
+
+func TestUnhealthySetCountsSources(t *testing.T) {
+	var s UnhealthySet
+	if s.Contains("a") || s.Len() != 0 {
+		t.Fatal("zero value is not empty")
+	}
+
+	// A health checker and an outlier detector both report "a"
+	s.Report("a", false)
+	s.Report("a", false)
+	s.Report("a", true)
+	if !s.Contains("a") || s.Len() != 1 {
+		t.Fatal(`"a" healthy after only one of two sources recovered`)
+	}
+	s.Report("a", true)
+	if s.Contains("a") || s.Len() != 0 {
+		t.Fatal(`"a" still unhealthy after both sources recovered`)
+	}
+
+	// Unmatched healthy reports do not go negative
+	s.Report("b", true)
+	s.Report("b", false)
+	if !s.Contains("b") {
+		t.Fatal(`"b" healthy after an unhealthy report`)
+	}
+}
@@ -1,61 +1,155 @@
 package proxy
 
 import (
+	"bytes"
+	"io"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"strconv"
 	"strings"
 
+	"github.com/hanapedia/maglseven/pkg/health"
 	"github.com/hanapedia/maglseven/pkg/maglev"
 )
 
 type HandoffProxy struct {
-	destPort     string
+	pool         *Pool
 	router       *maglev.VersionedRouter
 	replicaCount int
 	maxJumps     int
+	retry        RetryPolicy
 }
 
 func NewHandoffProxy(destPort string, router *maglev.VersionedRouter, replicaCount, maxJumps int) *HandoffProxy {
 	return &HandoffProxy{
-		destPort:     destPort,
+		pool:         NewPool(destPort, TransportConfig{}),
 		router:       router,
 		replicaCount: replicaCount,
 		maxJumps:     maxJumps,
 	}
 }
 
+// SetPool replaces the default pool, e.g., with a tuned TransportConfig
+func (p *HandoffProxy) SetPool(pool *Pool) {
+	p.pool = pool
+}
+
+// Pool returns the per-backend proxy pool
+func (p *HandoffProxy) Pool() *Pool {
+	return p.pool
+}
+
+// SetOutlierDetector reports every backend response to o for passive ejection
+func (p *HandoffProxy) SetOutlierDetector(o *health.OutlierDetector) {
+	p.pool.SetOutlierDetector(o)
+}
+
+// SetRetryPolicy enables failover of requests to the replication peers
+// when the primary fails with a connection error
+func (p *HandoffProxy) SetRetryPolicy(policy RetryPolicy) {
+	p.retry = policy
+}
+
+// conditionalHeaders are the maglev headers ServeHTTP sets only when
+// they apply to the request
+var conditionalHeaders = []string{
+	maglev.HeaderPreviousPrimary,
+	maglev.HeaderPreviousPeers,
+	maglev.HeaderOwner,
+	maglev.HeaderTemporaryOwner,
+	maglev.HeaderUnderReplicated,
+	maglev.HeaderFailover,
+}
+
 func (p *HandoffProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	key := r.Header.Get("X-Room-ID")
 	clientGenHeader := r.Header.Get(maglev.HeaderGeneration)
 
 	result := p.router.Route(key, clientGenHeader, p.replicaCount, p.maxJumps)
 
-	target, err := url.Parse("http://" + strings.TrimSpace(result.Backend.ID) + ":" + p.destPort)
-	if err != nil {
-		http.Error(w, "Invalid backend URL", http.StatusBadGateway)
-		return
+	// The cached proxy is shared, so inject headers on a copy of the
+	// incoming request; its Director carries them to the outbound one
+	req := r.Clone(r.Context())
+	// The headers below are only set when they apply, so drop any the
+	// client sent rather than forward them as the router's
+	for _, header := range conditionalHeaders {
+		req.Header.Del(header)
+	}
+	req.Header.Set(maglev.HeaderGeneration, strconv.FormatUint(result.Generation, 10))
+	req.Header.Set(maglev.HeaderReplicationPeers, joinPeers(result.Peers))
+
+	if result.RequiresRecovery && result.PrevPrimary != nil {
+		req.Header.Set(maglev.HeaderPreviousPrimary, result.PrevPrimary.ID)
+		req.Header.Set(maglev.HeaderPreviousPeers, joinPeers(result.PrevPeers))
+	}
+
+	if result.Owner != nil {
+		req.Header.Set(maglev.HeaderOwner, result.Owner.ID)
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
+	if result.TemporaryOwner {
+		req.Header.Set(maglev.HeaderTemporaryOwner, "true")
+	}
+
+	if result.UnderReplicated {
+		req.Header.Set(maglev.HeaderUnderReplicated, "true")
+	}
+
+	// Fail over to the peers in X-Maglev-Replication-Peers order. The
+	// body is only buffered if there is a peer to replay it to.
+	targets := []maglev.Backend{result.Backend}
+	var body []byte
+	if p.retry.allows(req) && len(result.Peers) > 0 {
+		if buffered, ok := bufferBody(req, p.retry.MaxBodyBytes); ok {
+			body = buffered
+			targets = append(targets, result.Peers[:min(len(result.Peers), p.retry.MaxRetries)]...)
+		}
+	}
 
-	// Customize the Director to inject headers
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		originalDirector(req) // copies method, URL, etc. from incoming request
+	for i, target := range targets {
+		last := i == len(targets)-1
+		attemptReq := req
+		if len(targets) > 1 {
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = http.NoBody
+			if body != nil {
+				attemptReq.Body = io.NopCloser(bytes.NewReader(body))
+			}
+		}
+		if i > 0 {
+			attemptReq.Header.Set(maglev.HeaderFailover, result.Backend.ID)
+		}
 
-		// Copy our custom headers to outbound request
-		req.Header.Set(maglev.HeaderGeneration, strconv.FormatUint(result.Generation, 10))
-		req.Header.Set(maglev.HeaderReplicationPeers, joinPeers(result.Peers))
+		var a *attempt
+		if !last {
+			a = &attempt{}
+			attemptReq = withAttempt(attemptReq, a)
+		}
+		if !p.serve(w, attemptReq, target) {
+			return
+		}
 
-		if result.RequiresRecovery && result.PrevPrimary != nil {
-			req.Header.Set(maglev.HeaderPreviousPrimary, result.PrevPrimary.ID)
-			req.Header.Set(maglev.HeaderPreviousPeers, joinPeers(result.PrevPeers))
+		// Retry only connection errors, and not once the client is gone
+		if a == nil || a.err == nil || r.Context().Err() != nil {
+			return
 		}
 	}
+}
+
+// serve proxies req to the backend and reports whether it did so
+func (p *HandoffProxy) serve(w http.ResponseWriter, req *http.Request, backend maglev.Backend) bool {
+	proxy, err := p.pool.get(backend)
+	if err != nil {
+		http.Error(w, "Invalid backend URL", http.StatusBadGateway)
+		return false
+	}
+
+	// Count in-flight requests for bounded-load routing
+	loads := p.router.LoadTracker()
+	loads.Acquire(backend.ID)
+	defer loads.Release(backend.ID)
 
-	proxy.ServeHTTP(w, r)
+	proxy.ServeHTTP(w, req)
+	return true
 }
 
 func joinPeers(peers []maglev.Backend) string {
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// echoServer responds with the request body and the failover header
+func echoServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(maglev.HeaderFailover, r.Header.Get(maglev.HeaderFailover))
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// closedAddr returns a local address with nothing listening on it
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	return addr
+}
+
+func newTestHandoffProxy(t *testing.T, backends []maglev.Backend, policy RetryPolicy) *HandoffProxy {
+	t.Helper()
+	table, err := maglev.Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	router := maglev.NewVersionedRouter(1)
+	router.AddGeneration(1, table)
+
+	p := NewHandoffProxy("80", router, len(backends), len(backends))
+	p.SetRetryPolicy(policy)
+	t.Cleanup(p.Pool().Close)
+	return p
+}
+
+func put(p http.Handler, room, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+	req.Header.Set("X-Room-ID", room)
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandoffProxyRetryWithoutPeersSendsBody(t *testing.T) {
+	srv := echoServer(t)
+	backends := []maglev.Backend{{ID: "a", Address: srv.Listener.Addr().String()}}
+	p := newTestHandoffProxy(t, backends, RetryPolicy{MaxRetries: 2, MaxBodyBytes: 1024})
+
+	rec := put(p, "room-1", "hello")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("got %d %q, want 200 \"hello\"", rec.Code, rec.Body.String())
+	}
+}
+
+func TestHandoffProxyFailsOverWithBody(t *testing.T) {
+	srv := echoServer(t)
+
+	// Point the key's primary at a closed port and its peer at the server
+	backends := []maglev.Backend{{ID: "a", FailureDomain: "zone-a"}, {ID: "b", FailureDomain: "zone-b"}}
+	table, err := maglev.Build(backends, 1009)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	primary := table.Lookup("room-1").ID
+	for i := range backends {
+		backends[i].Address = srv.Listener.Addr().String()
+		if backends[i].ID == primary {
+			backends[i].Address = closedAddr(t)
+		}
+	}
+
+	p := newTestHandoffProxy(t, backends, RetryPolicy{MaxRetries: 1, MaxBodyBytes: 1024})
+	rec := put(p, "room-1", "hello")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("got %d %q, want 200 \"hello\"", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get(maglev.HeaderFailover); got != primary {
+		t.Fatalf("%s = %q, want %q", maglev.HeaderFailover, got, primary)
+	}
+
+	// Without retries the client sees the primary's failure
+	p = newTestHandoffProxy(t, backends, RetryPolicy{})
+	if rec := put(p, "room-1", "hello"); rec.Code != http.StatusBadGateway {
+		t.Fatalf("got %d without retries, want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestHandoffProxyDropsClientRoutingHeaders(t *testing.T) {
+	received := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	t.Cleanup(srv.Close)
+
+	backends := []maglev.Backend{{ID: "a", Address: srv.Listener.Addr().String()}}
+	p := newTestHandoffProxy(t, backends, RetryPolicy{})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Room-ID", "room-1")
+	for _, header := range conditionalHeaders {
+		req.Header.Set(header, "spoofed")
+	}
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	header := <-received
+	for _, name := range conditionalHeaders {
+		if got := header.Get(name); got != "" {
+			t.Errorf("%s = %q forwarded from the client", name, got)
+		}
+	}
+	if got := header.Get(maglev.HeaderGeneration); got != "1" {
+		t.Errorf("%s = %q, want 1", maglev.HeaderGeneration, got)
+	}
+}
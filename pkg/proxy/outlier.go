@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"sync/atomic"
+
+	"github.com/hanapedia/maglseven/pkg/health"
+)
+
+// observe reports each response or transport error from proxy to the
+// current outlier detector as the outcome of a request to the backend.
+// Errors from requests the client canceled are not the backend's fault.
+func observe(proxy *httputil.ReverseProxy, outliers *atomic.Pointer[health.OutlierDetector], backendID string) {
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		outliers.Load().Report(backendID, resp.StatusCode < http.StatusInternalServerError)
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if r.Context().Err() == nil && !errors.Is(err, context.Canceled) {
+			outliers.Load().Report(backendID, false)
+		}
+		// Leave the response to the caller if it may retry elsewhere
+		if a := attemptFrom(r); a != nil {
+			a.err = err
+			return
+		}
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hanapedia/maglseven/pkg/health"
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+func TestObserveIgnoresCanceledRequests(t *testing.T) {
+	newObserved := func() (*httputil.ReverseProxy, *health.OutlierDetector) {
+		detector := health.NewOutlierDetector(health.OutlierConfig{ConsecutiveErrors: 1, MaxEjectedPercent: 100})
+		detector.SetBackends([]maglev.Backend{{ID: "a"}})
+		var outliers atomic.Pointer[health.OutlierDetector]
+		outliers.Store(detector)
+
+		proxy := &httputil.ReverseProxy{}
+		observe(proxy, &outliers, "a")
+		return proxy, detector
+	}
+
+	t.Run("client canceled", func(t *testing.T) {
+		proxy, detector := newObserved()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req := httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil)
+		proxy.ErrorHandler(httptest.NewRecorder(), req, ctx.Err())
+		if detector.Ejected("a") {
+			t.Fatal("backend ejected for a canceled request")
+		}
+	})
+
+	t.Run("canceled error", func(t *testing.T) {
+		proxy, detector := newObserved()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		proxy.ErrorHandler(httptest.NewRecorder(), req, context.Canceled)
+		if detector.Ejected("a") {
+			t.Fatal("backend ejected for a canceled request")
+		}
+	})
+
+	t.Run("backend error", func(t *testing.T) {
+		proxy, detector := newObserved()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rec := httptest.NewRecorder()
+		proxy.ErrorHandler(rec, req, errors.New("connection refused"))
+		if !detector.Ejected("a") {
+			t.Fatal("backend not ejected after a connection error")
+		}
+		if rec.Code != http.StatusBadGateway {
+			t.Fatalf("status %d, want %d", rec.Code, http.StatusBadGateway)
+		}
+	})
+}
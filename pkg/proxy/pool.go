@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/health"
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// TransportConfig tunes the connection pool of each backend's transport.
+// Zero fields keep the defaults of http.DefaultTransport.
+type TransportConfig struct {
+	MaxIdleConnsPerHost   int
+	MaxConnsPerHost       int
+	IdleConnTimeout       time.Duration
+	ResponseHeaderTimeout time.Duration
+	DialTimeout           time.Duration
+	KeepAlive             time.Duration // TCP keep-alive period; negative disables
+	DisableKeepAlives     bool          // disables HTTP connection reuse
+}
+
+type backendProxy struct {
+	addr      string
+	proxy     *httputil.ReverseProxy
+	transport *http.Transport
+}
+
+// Pool caches a reverse proxy and transport per backend ID, so
+// connections to a backend are reused across requests
+type Pool struct {
+	destPort string
+	cfg      TransportConfig
+	outliers atomic.Pointer[health.OutlierDetector]
+
+	mu       sync.RWMutex
+	backends map[string]*backendProxy // backend ID -> cached proxy
+}
+
+// NewPool returns an empty pool proxying to each backend's Address, or
+// to destPort on backends without one
+func NewPool(destPort string, cfg TransportConfig) *Pool {
+	return &Pool{
+		destPort: destPort,
+		cfg:      cfg,
+		backends: make(map[string]*backendProxy),
+	}
+}
+
+// SetOutlierDetector reports every backend response to o for passive ejection
+func (p *Pool) SetOutlierDetector(o *health.OutlierDetector) {
+	p.outliers.Store(o)
+}
+
+// SetBackends creates proxies for new or readdressed backends and closes
+// the idle connections of replaced ones, e.g., on every watcher update
+func (p *Pool) SetBackends(backends []maglev.Backend) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	next := make(map[string]*backendProxy, len(backends))
+	for _, b := range backends {
+		if bp, ok := p.backends[b.ID]; ok && bp.addr == b.Addr(p.destPort) {
+			next[b.ID] = bp
+			continue
+		}
+		bp, err := p.newBackendProxy(b)
+		if err != nil {
+			return err
+		}
+		next[b.ID] = bp
+	}
+	for id, bp := range p.backends {
+		if next[id] != bp {
+			bp.transport.CloseIdleConnections()
+		}
+	}
+	p.backends = next
+	return nil
+}
+
+// Close closes the idle connections of every backend
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, bp := range p.backends {
+		bp.transport.CloseIdleConnections()
+	}
+	p.backends = make(map[string]*backendProxy)
+}
+
+// get returns the cached proxy for the backend, creating it if the
+// backend was routed to before it was added
+func (p *Pool) get(backend maglev.Backend) (*httputil.ReverseProxy, error) {
+	addr := backend.Addr(p.destPort)
+
+	p.mu.RLock()
+	bp, ok := p.backends[backend.ID]
+	p.mu.RUnlock()
+	if ok && bp.addr == addr {
+		return bp.proxy, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if bp, ok := p.backends[backend.ID]; ok && bp.addr == addr {
+		return bp.proxy, nil
+	}
+	bp, err := p.newBackendProxy(backend)
+	if err != nil {
+		return nil, err
+	}
+	p.backends[backend.ID] = bp
+	return bp.proxy, nil
+}
+
+func (p *Pool) newBackendProxy(backend maglev.Backend) (*backendProxy, error) {
+	addr := backend.Addr(p.destPort)
+	target, err := url.Parse("http://" + addr)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := p.newTransport()
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	observe(proxy, &p.outliers, backend.ID)
+
+	return &backendProxy{addr: addr, proxy: proxy, transport: transport}, nil
+}
+
+func (p *Pool) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if p.cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = p.cfg.MaxIdleConnsPerHost
+		transport.MaxIdleConns = max(transport.MaxIdleConns, p.cfg.MaxIdleConnsPerHost)
+	}
+	if p.cfg.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = p.cfg.MaxConnsPerHost
+	}
+	if p.cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = p.cfg.IdleConnTimeout
+	}
+	if p.cfg.ResponseHeaderTimeout > 0 {
+		transport.ResponseHeaderTimeout = p.cfg.ResponseHeaderTimeout
+	}
+	transport.DisableKeepAlives = p.cfg.DisableKeepAlives
+
+	if p.cfg.DialTimeout != 0 || p.cfg.KeepAlive != 0 {
+		// Same defaults as http.DefaultTransport's dialer
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		if p.cfg.DialTimeout > 0 {
+			dialer.Timeout = p.cfg.DialTimeout
+		}
+		if p.cfg.KeepAlive != 0 {
+			dialer.KeepAlive = p.cfg.KeepAlive
+		}
+		transport.DialContext = dialer.DialContext
+	}
+	return transport
+}
@@ -2,30 +2,47 @@ package proxy
 
 import (
 	"net/http"
-	"net/http/httputil"
-	"net/url"
-	"strings"
 
 	"github.com/hanapedia/maglseven/pkg/dispatcher"
+	"github.com/hanapedia/maglseven/pkg/health"
 )
 
 type Proxy struct {
-	destPort string
+	pool *Pool
 	dispatcher *dispatcher.Dispatcher
 }
 
 func NewProxy(dp string, d *dispatcher.Dispatcher) *Proxy {
-	return &Proxy{destPort: dp, dispatcher: d}
+	return &Proxy{pool: NewPool(dp, TransportConfig{}), dispatcher: d}
+}
+
+// SetPool replaces the default pool, e.g., with a tuned TransportConfig
+func (p *Proxy) SetPool(pool *Pool) {
+	p.pool = pool
+}
+
+// Pool returns the per-backend proxy pool
+func (p *Proxy) Pool() *Pool {
+	return p.pool
+}
+
+// SetOutlierDetector reports every backend response to o for passive ejection
+func (p *Proxy) SetOutlierDetector(o *health.OutlierDetector) {
+	p.pool.SetOutlierDetector(o)
 }
 
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	backendHost := p.dispatcher.Route(r)
-	target, err := url.Parse("http://" + strings.TrimSpace(backendHost) + ":" + p.destPort)
+	backend := p.dispatcher.RouteBackend(r)
+	proxy, err := p.pool.get(backend)
 	if err != nil {
 		http.Error(w, "Invalid backend URL", http.StatusBadGateway)
 		return
 	}
 
-	proxy := httputil.NewSingleHostReverseProxy(target)
+	// Count in-flight requests for bounded-load routing
+	loads := p.dispatcher.LoadTracker()
+	loads.Acquire(backend.ID)
+	defer loads.Release(backend.ID)
+
 	proxy.ServeHTTP(w, r)
 }
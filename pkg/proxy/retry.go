@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// DefaultRetryMethods are the idempotent methods retried by default
+var DefaultRetryMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// RetryPolicy configures failover of a request to the replication peers
+// when its backend fails with a connection error
+type RetryPolicy struct {
+	MaxRetries   int      // peers tried after the primary; 0 disables failover
+	Methods      []string // methods safe to retry; nil means DefaultRetryMethods
+	MaxBodyBytes int64    // larger request bodies are not buffered or retried
+}
+
+// allows reports whether the policy permits retrying req's method
+func (rp RetryPolicy) allows(req *http.Request) bool {
+	methods := rp.Methods
+	if methods == nil {
+		methods = DefaultRetryMethods
+	}
+	return rp.MaxRetries > 0 && slices.Contains(methods, req.Method)
+}
+
+// bufferBody reads req's body into memory so it can be replayed on
+// failover. It reports false, leaving the body readable from the start,
+// if the body exceeds limit bytes or fails to read.
+func bufferBody(req *http.Request, limit int64) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > limit {
+		return nil, false
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil || int64(len(buf)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return nil, false
+	}
+	return buf, true
+}
+
+// attempt records the connection error of a proxied request that may be
+// retried, in place of the proxy's 502 response
+type attempt struct {
+	err error
+}
+
+type attemptKey struct{}
+
+func withAttempt(req *http.Request, a *attempt) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), attemptKey{}, a))
+}
+
+func attemptFrom(req *http.Request) *attempt {
+	a, _ := req.Context().Value(attemptKey{}).(*attempt)
+	return a
+}
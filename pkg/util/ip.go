@@ -6,25 +6,41 @@ import (
 	"strconv"
 )
 
+// ParseIPMask parses a dotted IPv4 or an IPv6 mask, e.g., "255.255.255.0"
+// or "ffff:ffff:ffff:ffff::"
 func ParseIPMask(maskStr string) (net.IPMask, error) {
 	ip := net.ParseIP(maskStr)
 	if ip == nil {
 		return nil, fmt.Errorf("invalid IP mask string: %q", maskStr)
 	}
-	ip4 := ip.To4()
-	if ip4 == nil {
-		return nil, fmt.Errorf("not a valid IPv4 mask: %q", maskStr)
+	mask := net.IPMask(ip.To16())
+	if ip4 := ip.To4(); ip4 != nil {
+		mask = net.IPv4Mask(ip4[0], ip4[1], ip4[2], ip4[3])
 	}
-	return net.IPv4Mask(ip4[0], ip4[1], ip4[2], ip4[3]), nil
+	if _, bits := mask.Size(); bits == 0 {
+		return nil, fmt.Errorf("not a canonical IP mask: %q", maskStr)
+	}
+	return mask, nil
 }
 
+// ParseCIDRMaskFromString parses an IPv4 prefix length (0-32)
 func ParseCIDRMaskFromString(s string) (net.IPMask, error) {
+	return ParseCIDRMask(s, 8*net.IPv4len)
+}
+
+// ParseCIDRMask6FromString parses an IPv6 prefix length (0-128)
+func ParseCIDRMask6FromString(s string) (net.IPMask, error) {
+	return ParseCIDRMask(s, 8*net.IPv6len)
+}
+
+// ParseCIDRMask parses a prefix length for an address of the given bits
+func ParseCIDRMask(s string, bits int) (net.IPMask, error) {
 	prefixLen, err := strconv.Atoi(s)
 	if err != nil {
 		return nil, fmt.Errorf("invalid prefix length: %q", s)
 	}
-	if prefixLen < 0 || prefixLen > 32 {
-		return nil, fmt.Errorf("invalid prefix length: %d (must be between 0 and 32)", prefixLen)
+	if prefixLen < 0 || prefixLen > bits {
+		return nil, fmt.Errorf("invalid prefix length: %d (must be between 0 and %d)", prefixLen, bits)
 	}
-	return net.CIDRMask(prefixLen, 32), nil
+	return net.CIDRMask(prefixLen, bits), nil
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"sort"
+	"strconv"
 
 	"github.com/hanapedia/maglseven/pkg/maglev"
 )
@@ -11,7 +12,7 @@ import (
 func HashBackends(backends []maglev.Backend) string {
 	ids := make([]string, 0, len(backends))
 	for _, b := range backends {
-		ids = append(ids, b.ID)
+		ids = append(ids, b.ID+"/"+strconv.FormatUint(uint64(b.Weight), 10)+"/"+b.FailureDomain+"/"+b.Address)
 	}
 	sort.Strings(ids)
 
@@ -2,7 +2,9 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/hanapedia/maglseven/pkg/maglev"
@@ -10,39 +12,46 @@ import (
 )
 
 type DNSWatcher struct {
-	FQDN        string // e.g., "myapp.default.svc.cluster.local"
-	Interval    time.Duration
-	FailureCIDR *net.IPMask // e.g., /24 to extract failure domain
+	FQDN         string // e.g., "myapp.default.svc.cluster.local"
+	Interval     time.Duration
+	FailureCIDR  *net.IPMask // e.g., /24 to extract failure domain of IPv4 addresses
+	FailureCIDR6 *net.IPMask // e.g., /64 to extract failure domain of IPv6 addresses
+	Family       IPFamily    // address families to send; defaults to IPv4, else IPv6
+
+	Server          string        // "host:port" of the DNS server; empty uses the system resolver
+	Protocol        string        // "udp" or "tcp" to reach Server; empty lets the resolver choose
+	Timeout         time.Duration // per-query timeout; 0 means none
+	OnError         func(error)   // called on every failed resolution after the first
+	ClearOnNotFound bool          // on NXDOMAIN, send an empty set (see Watcher); other failures always keep the last set
+
+	counters dnsCounters
+}
+
+// DNSStats counts the resolutions of a DNSWatcher or SRVWatcher
+type DNSStats struct {
+	Lookups     uint64
+	Failures    uint64 // all failed lookups, including the ones below
+	NotFound    uint64 // NXDOMAIN
+	ServerFails uint64 // SERVFAIL and other temporary server errors
+	Timeouts    uint64
+	Updates     uint64 // backend sets sent
+	LastError   error
+	LastSuccess time.Time
+}
+
+// Stats returns a snapshot of the watcher's resolution counters
+func (w *DNSWatcher) Stats() DNSStats {
+	return w.counters.snapshot()
 }
 
 func (w *DNSWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend) error {
 	ticker := time.NewTicker(w.Interval)
 	defer ticker.Stop()
 
+	resolver := w.resolver()
 	var lastHash string
 
-	resolveAndSend := func() error {
-		ips, err := net.LookupIP(w.FQDN)
-		if err != nil {
-			return err
-		}
-
-		backends := make([]maglev.Backend, 0, len(ips))
-		for _, ip := range ips {
-			if ip.To4() == nil {
-				continue // skip IPv6
-			}
-			failureDomain := ip.String()
-			if w.FailureCIDR != nil {
-				maskedIP := ip.Mask(*w.FailureCIDR)
-				failureDomain = maskedIP.String()
-			}
-			backends = append(backends, maglev.Backend{
-				ID:            ip.String(),
-				FailureDomain: failureDomain,
-			})
-		}
-
+	send := func(backends []maglev.Backend) error {
 		newHash := util.HashBackends(backends)
 		if newHash == lastHash {
 			return nil // no change
@@ -51,12 +60,60 @@ func (w *DNSWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend)
 
 		select {
 		case updates <- backends:
+			w.counters.record(func(s *DNSStats) { s.Updates++ })
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 		return nil
 	}
 
+	resolveAndSend := func() error {
+		lookupCtx := ctx
+		if w.Timeout > 0 {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithTimeout(ctx, w.Timeout)
+			defer cancel()
+		}
+
+		w.counters.record(func(s *DNSStats) { s.Lookups++ })
+		ips, err := resolver.LookupIP(lookupCtx, "ip", w.FQDN)
+		if err != nil {
+			notFound := w.counters.recordFailure(err)
+			if notFound && w.ClearOnNotFound && lastHash != "" {
+				// The server says the name has no backends (anymore)
+				if sendErr := send(nil); sendErr != nil {
+					return sendErr
+				}
+			}
+			return err
+		}
+		w.counters.record(func(s *DNSStats) { s.LastSuccess = time.Now() })
+
+		var v4, v6 []maglev.Backend
+		for _, ip := range ips {
+			failureDomain := ip.String()
+			mask := w.FailureCIDR6
+			if ip.To4() != nil {
+				mask = w.FailureCIDR
+			}
+			if mask != nil {
+				failureDomain = ip.Mask(*mask).String()
+			}
+
+			backend := maglev.Backend{
+				ID:            ip.String(),
+				FailureDomain: failureDomain,
+				Weight:        1,
+			}
+			if ip.To4() != nil {
+				v4 = append(v4, backend)
+			} else {
+				v6 = append(v6, backend)
+			}
+		}
+		return send(w.Family.choose(v4, v6))
+	}
+
 	if err := resolveAndSend(); err != nil {
 		return err
 	}
@@ -64,9 +121,70 @@ func (w *DNSWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend)
 	for {
 		select {
 		case <-ticker.C:
-			_ = resolveAndSend()
+			if err := resolveAndSend(); err != nil && ctx.Err() == nil && w.OnError != nil {
+				w.OnError(err)
+			}
 		case <-ctx.Done():
 			return ctx.Err()
 		}
 	}
 }
+
+// resolver returns a resolver querying Server, or the system resolver
+func (w *DNSWatcher) resolver() *net.Resolver {
+	if w.Server == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			if w.Protocol != "" {
+				network = w.Protocol
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, w.Server)
+		},
+	}
+}
+
+// dnsCounters guards the DNSStats of a watcher
+type dnsCounters struct {
+	mu    sync.Mutex
+	stats DNSStats
+}
+
+func (c *dnsCounters) snapshot() DNSStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *dnsCounters) record(fn func(*DNSStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.stats)
+}
+
+// recordFailure counts a failed lookup and reports whether the server
+// answered with NXDOMAIN
+func (c *dnsCounters) recordFailure(err error) bool {
+	var dnsErr *net.DNSError
+	isDNSErr := errors.As(err, &dnsErr)
+	notFound := isDNSErr && dnsErr.IsNotFound
+	timeout := isDNSErr && dnsErr.IsTimeout
+	serverFail := isDNSErr && dnsErr.IsTemporary && !timeout && !notFound
+
+	c.record(func(s *DNSStats) {
+		s.Failures++
+		s.LastError = err
+		switch {
+		case notFound:
+			s.NotFound++
+		case timeout:
+			s.Timeouts++
+		case serverFail:
+			s.ServerFails++
+		}
+	})
+	return notFound
+}
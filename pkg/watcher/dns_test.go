@@ -0,0 +1,142 @@
+package watcher
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func newTestDNSWatcher(dns *testDNSServer) *DNSWatcher {
+	return &DNSWatcher{
+		FQDN:     "web.test.",
+		Interval: 10 * time.Millisecond,
+		Server:   dns.addr(),
+		Protocol: "udp",
+		Timeout:  time.Second,
+	}
+}
+
+// waitForFailures waits until w has counted n more failed lookups
+func waitForFailures(t *testing.T, w *DNSWatcher, n uint64) {
+	t.Helper()
+	want := w.Stats().Failures + n
+	deadline := time.Now().Add(10 * time.Second)
+	for w.Stats().Failures < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d failed lookups", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func assertNoUpdate(t *testing.T, updates <-chan []maglev.Backend) {
+	t.Helper()
+	select {
+	case backends := <-updates:
+		t.Fatalf("unexpected update %v", backends)
+	default:
+	}
+}
+
+func TestDNSWatcher(t *testing.T) {
+	dns := newTestDNSServer(t)
+	dns.setIPs("web.test.", "10.0.1.1", "10.0.2.1", "fd00::1")
+
+	w := newTestDNSWatcher(dns)
+	mask := net.CIDRMask(24, 32)
+	w.FailureCIDR = &mask
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend)
+	go w.Watch(ctx, updates)
+
+	got := receiveBackends(t, updates)
+	slices.SortFunc(got, func(a, b maglev.Backend) int { return cmp.Compare(a.ID, b.ID) })
+	want := []maglev.Backend{
+		{ID: "10.0.1.1", FailureDomain: "10.0.1.0", Weight: 1},
+		{ID: "10.0.2.1", FailureDomain: "10.0.2.0", Weight: 1},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("backends = %+v, want %+v", got, want)
+	}
+
+	dns.setIPs("web.test.", "10.0.1.1")
+	if got := backendIDs(receiveBackends(t, updates)); !slices.Equal(got, []string{"10.0.1.1"}) {
+		t.Fatalf("backends after update = %v", got)
+	}
+
+	stats := w.Stats()
+	if stats.Updates != 2 || stats.Lookups < 2 || stats.Failures != 0 || stats.LastSuccess.IsZero() {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestDNSWatcherKeepsLastSetOnFailure(t *testing.T) {
+	dns := newTestDNSServer(t)
+	dns.setIPs("web.test.", "10.0.0.1")
+
+	w := newTestDNSWatcher(dns)
+	errs := make(chan error, 100)
+	w.OnError = func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend, 10)
+	go w.Watch(ctx, updates)
+	receiveBackends(t, updates)
+
+	dns.setRCode(dnsmessage.RCodeServerFailure)
+	waitForFailures(t, w, 2)
+	assertNoUpdate(t, updates)
+	if stats := w.Stats(); stats.ServerFails == 0 || stats.LastError == nil {
+		t.Fatalf("stats after SERVFAIL = %+v", stats)
+	}
+	if len(errs) == 0 {
+		t.Fatal("OnError was not called")
+	}
+
+	dns.setRCode(dnsmessage.RCodeSuccess)
+	dns.remove("web.test.")
+	waitForFailures(t, w, 2)
+	assertNoUpdate(t, updates)
+	if stats := w.Stats(); stats.NotFound == 0 {
+		t.Fatalf("stats after NXDOMAIN = %+v", stats)
+	}
+}
+
+func TestDNSWatcherClearOnNotFound(t *testing.T) {
+	dns := newTestDNSServer(t)
+	dns.setIPs("web.test.", "10.0.0.1")
+
+	w := newTestDNSWatcher(dns)
+	w.ClearOnNotFound = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend, 10)
+	go w.Watch(ctx, updates)
+	receiveBackends(t, updates)
+
+	// SERVFAIL still keeps the last set
+	dns.setRCode(dnsmessage.RCodeServerFailure)
+	waitForFailures(t, w, 2)
+	assertNoUpdate(t, updates)
+
+	dns.setRCode(dnsmessage.RCodeSuccess)
+	dns.remove("web.test.")
+	if got := receiveBackends(t, updates); len(got) != 0 {
+		t.Fatalf("backends after NXDOMAIN = %v, want none", got)
+	}
+}
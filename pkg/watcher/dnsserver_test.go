@@ -0,0 +1,170 @@
+package watcher
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer is an in-process UDP DNS server answering A, AAAA and
+// SRV questions from records that tests may change at any time
+type testDNSServer struct {
+	conn net.PacketConn
+
+	mu    sync.Mutex
+	ips   map[string][]net.IP  // name -> A and AAAA records
+	srvs  map[string][]net.SRV // name -> SRV records
+	rcode dnsmessage.RCode     // forced response code, unless success
+}
+
+func newTestDNSServer(t *testing.T) *testDNSServer {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &testDNSServer{
+		conn: conn,
+		ips:  make(map[string][]net.IP),
+		srvs: make(map[string][]net.SRV),
+	}
+	t.Cleanup(func() { conn.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *testDNSServer) addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// resolver returns a resolver that only queries s
+func (s *testDNSServer) resolver() *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", s.addr())
+		},
+	}
+}
+
+func (s *testDNSServer) setIPs(name string, ips ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parsed := make([]net.IP, len(ips))
+	for i, ip := range ips {
+		parsed[i] = net.ParseIP(ip)
+	}
+	s.ips[name] = parsed
+}
+
+func (s *testDNSServer) setSRVs(name string, srvs ...net.SRV) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.srvs[name] = srvs
+}
+
+func (s *testDNSServer) remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ips, name)
+	delete(s.srvs, name)
+}
+
+func (s *testDNSServer) setRCode(rcode dnsmessage.RCode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rcode = rcode
+}
+
+func (s *testDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if resp, err := s.answer(buf[:n]); err == nil {
+			s.conn.WriteTo(resp, addr)
+		}
+	}
+}
+
+func (s *testDNSServer) answer(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := strings.ToLower(q.Name.String())
+	ips, hasIPs := s.ips[name]
+	srvs, hasSRVs := s.srvs[name]
+
+	rcode := s.rcode
+	if rcode == dnsmessage.RCodeSuccess && !hasIPs && !hasSRVs {
+		rcode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:            header.ID,
+		Response:      true,
+		Authoritative: true,
+		RCode:         rcode,
+	})
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(q); err != nil {
+		return nil, err
+	}
+	if err := b.StartAnswers(); err != nil {
+		return nil, err
+	}
+
+	rh := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET}
+	if rcode == dnsmessage.RCodeSuccess {
+		switch q.Type {
+		case dnsmessage.TypeA:
+			for _, ip := range ips {
+				if ip4 := ip.To4(); ip4 != nil {
+					err = b.AResource(rh, dnsmessage.AResource{A: [4]byte(ip4)})
+				}
+			}
+		case dnsmessage.TypeAAAA:
+			for _, ip := range ips {
+				if ip.To4() == nil {
+					err = b.AAAAResource(rh, dnsmessage.AAAAResource{AAAA: [16]byte(ip.To16())})
+				}
+			}
+		case dnsmessage.TypeSRV:
+			for _, srv := range srvs {
+				var target dnsmessage.Name
+				if target, err = dnsmessage.NewName(srv.Target); err != nil {
+					break
+				}
+				err = b.SRVResource(rh, dnsmessage.SRVResource{
+					Priority: srv.Priority,
+					Weight:   srv.Weight,
+					Port:     srv.Port,
+					Target:   target,
+				})
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Finish()
+}
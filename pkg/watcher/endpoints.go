@@ -2,106 +2,176 @@ package watcher
 
 import (
 	"context"
-	/* "fmt" */
-	/* "time" */
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/hanapedia/maglseven/pkg/maglev"
-	/* "github.com/hanapedia/maglseven/pkg/util" */
-	/* discoveryv1 "k8s.io/api/discovery/v1" */
-	/* metav1 "k8s.io/apimachinery/pkg/apis/meta/v1" */
-	/* "k8s.io/client-go/informers" */
-	/* "k8s.io/client-go/kubernetes" */
-	/* "k8s.io/client-go/rest" */
-	/* "k8s.io/client-go/tools/cache" */
+	"github.com/hanapedia/maglseven/pkg/util"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 )
 
+// EndpointSlicesWatcher watches the EndpointSlices of a Service and sends
+// its ready endpoints, with "zone/node" as their failure domain
 type EndpointSlicesWatcher struct {
 	Namespace string
 	Service   string
-	Backends []maglev.Backend
+	Client    kubernetes.Interface // nil uses the in-cluster config
+	Resync    time.Duration        // informer resync period; 0 disables
+	Family    IPFamily             // address families to send; defaults to IPv4, else IPv6
 }
 
 func (w *EndpointSlicesWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend) error {
-	// Just send once and close the channel
-	select {
-	case updates <- w.Backends:
-	case <-ctx.Done():
-		return ctx.Err()
+	client := w.Client
+	if client == nil {
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get in-cluster config: %w", err)
+		}
+		client, err = kubernetes.NewForConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to create clientset: %w", err)
+		}
 	}
-	return nil
+
+	factory := informers.NewSharedInformerFactoryWithOptions(client, w.Resync,
+		informers.WithNamespace(w.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = discoveryv1.LabelServiceName + "=" + w.Service
+		}),
+	)
+	defer factory.Shutdown()
+
+	informer := factory.Discovery().V1().EndpointSlices().Informer()
+	store := informer.GetStore()
+
+	// Handlers and the initial send below race, so serialize them
+	var mu sync.Mutex
+	var lastHash string
+	send := func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		objs := store.List()
+		backends := w.Family.choose(
+			endpointBackends(objs, w.Service, discoveryv1.AddressTypeIPv4),
+			endpointBackends(objs, w.Service, discoveryv1.AddressTypeIPv6),
+		)
+		newHash := util.HashBackends(backends)
+		if newHash == lastHash {
+			return // no change
+		}
+		lastHash = newHash
+
+		select {
+		case updates <- backends:
+		case <-ctx.Done():
+		}
+	}
+
+	// The initial list is sent once, as a whole, after the sync below
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj any, isInInitialList bool) {
+			if !isInInitialList {
+				send()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj any) { send() },
+		DeleteFunc: func(obj any) { send() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		return errors.New("failed to sync cache")
+	}
+
+	// Send the initial set, even if the Service has no endpoints yet
+	send()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// endpointBackends returns one backend per ready address of the given
+// type. If no endpoint is ready, serving terminating endpoints are used
+// instead, as kube-proxy does, so rooms keep a backend during a rollout.
+func endpointBackends(objs []any, service string, addressType discoveryv1.AddressType) []maglev.Backend {
+	var ready, terminating []maglev.Backend
+	seenReady := make(map[string]struct{})
+	seenTerminating := make(map[string]struct{})
+
+	for _, obj := range objs {
+		es, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok || es.Labels[discoveryv1.LabelServiceName] != service || es.AddressType != addressType {
+			continue
+		}
+
+		for _, endpoint := range es.Endpoints {
+			// Nil conditions are unknown and, per the API, treated as ready
+			conditions := endpoint.Conditions
+			isReady := conditions.Ready == nil || *conditions.Ready
+			isServing := conditions.Serving == nil || *conditions.Serving
+			isTerminating := conditions.Terminating != nil && *conditions.Terminating
+
+			for _, addr := range endpoint.Addresses {
+				backend := maglev.Backend{
+					ID:            addr,
+					FailureDomain: endpointFailureDomain(endpoint, addr),
+					Weight:        1,
+				}
+				// An address may appear in more than one slice during updates
+				switch {
+				case isReady && !isTerminating:
+					ready = appendUnique(ready, seenReady, backend)
+				case isServing && isTerminating:
+					terminating = appendUnique(terminating, seenTerminating, backend)
+				}
+			}
+		}
+	}
+
+	if len(ready) == 0 {
+		return terminating
+	}
+	return ready
+}
+
+func appendUnique(backends []maglev.Backend, seen map[string]struct{}, backend maglev.Backend) []maglev.Backend {
+	if _, dup := seen[backend.ID]; dup {
+		return backends
+	}
+	seen[backend.ID] = struct{}{}
+	return append(backends, backend)
 }
 
-/* func (w *EndpointSlicesWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend) error { */
-/* 	config, err := rest.InClusterConfig() */
-/* 	if err != nil { */
-/* 		return fmt.Errorf("failed to get in-cluster config: %w", err) */
-/* 	} */
-/**/
-/* 	clientset, err := kubernetes.NewForConfig(config) */
-/* 	if err != nil { */
-/* 		return fmt.Errorf("failed to create clientset: %w", err) */
-/* 	} */
-/**/
-/* 	factory := informers.NewSharedInformerFactoryWithOptions(clientset, time.Minute, */
-/* 		informers.WithNamespace(w.Namespace), */
-/* 		informers.WithTweakListOptions(func(options *metav1.ListOptions) { */
-/* 			options.LabelSelector = fmt.Sprintf("kubernetes.io/service-name=%s", w.Service) */
-/* 		}), */
-/* 	) */
-/**/
-/* 	informer := factory.Discovery().V1().EndpointSlices().Informer() */
-/**/
-/* 	var lastHash string */
-/**/
-/* 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{ */
-/* 		AddFunc: func(obj any) { */
-/* 			w.processUpdate(informer, updates, &lastHash) */
-/* 		}, */
-/* 		UpdateFunc: func(oldObj, newObj any) { */
-/* 			w.processUpdate(informer, updates, &lastHash) */
-/* 		}, */
-/* 		DeleteFunc: func(obj any) { */
-/* 			w.processUpdate(informer, updates, &lastHash) */
-/* 		}, */
-/* 	}) */
-/**/
-/* 	stopCh := make(chan struct{}) */
-/* 	defer close(stopCh) */
-/**/
-/* 	factory.Start(stopCh) */
-/* 	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) { */
-/* 		return fmt.Errorf("failed to sync cache") */
-/* 	} */
-/**/
-/* 	<-ctx.Done() */
-/* 	return ctx.Err() */
-/* } */
-/**/
-/* func (w *EndpointSlicesWatcher) processUpdate(informer cache.SharedIndexInformer, updates chan<- []maglev.Backend, lastHash *string) { */
-/* 	slices := informer.GetStore().List() */
-/**/
-/* 	var backends []maglev.Backend */
-/* 	for _, obj := range slices { */
-/* 		es, ok := obj.(*discoveryv1.EndpointSlice) */
-/* 		if !ok { */
-/* 			continue */
-/* 		} */
-/**/
-/* 		for _, endpoint := range es.Endpoints { */
-/* 			if endpoint.Conditions.Ready != nil && *endpoint.Conditions.Ready { */
-/* 				for _, addr := range endpoint.Addresses { */
-/* 					backends = append(backends, maglev.Backend{ID: addr}) */
-/* 				} */
-/* 			} */
-/* 		} */
-/* 	} */
-/**/
-/* 	newHash := util.HashBackends(backends) */
-/* 	if newHash != *lastHash { */
-/* 		*lastHash = newHash */
-/* 		select { */
-/* 		case updates <- backends: */
-/* 		default: */
-/* 		} */
-/* 	} */
-/* } */
+// endpointFailureDomain returns "zone/node", or whichever of the two is
+// known, falling back to the address itself
+func endpointFailureDomain(endpoint discoveryv1.Endpoint, addr string) string {
+	var zone, node string
+	if endpoint.Zone != nil {
+		zone = *endpoint.Zone
+	}
+	if endpoint.NodeName != nil {
+		node = *endpoint.NodeName
+	}
+
+	switch {
+	case zone != "" && node != "":
+		return zone + maglev.FailureDomainSeparator + node
+	case zone != "":
+		return zone
+	case node != "":
+		return node
+	default:
+		return addr
+	}
+}
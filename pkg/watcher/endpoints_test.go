@@ -0,0 +1,161 @@
+package watcher
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func endpointSlice(name, service string, addressType discoveryv1.AddressType, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: addressType,
+		Endpoints:   endpoints,
+	}
+}
+
+func endpoint(addr, zone, node string, ready, serving, terminating bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses: []string{addr},
+		Zone:      &zone,
+		NodeName:  &node,
+		Conditions: discoveryv1.EndpointConditions{
+			Ready:       &ready,
+			Serving:     &serving,
+			Terminating: &terminating,
+		},
+	}
+}
+
+func backendIDs(backends []maglev.Backend) []string {
+	ids := make([]string, len(backends))
+	for i, b := range backends {
+		ids[i] = b.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func receiveBackends(t *testing.T, updates <-chan []maglev.Backend) []maglev.Backend {
+	t.Helper()
+	select {
+	case backends := <-updates:
+		return backends
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for backends")
+		return nil
+	}
+}
+
+func TestEndpointSlicesWatcher(t *testing.T) {
+	client := fake.NewClientset(
+		endpointSlice("web-1", "web", discoveryv1.AddressTypeIPv4,
+			endpoint("10.0.0.1", "zone-a", "node-1", true, true, false),
+		),
+		endpointSlice("other-1", "other", discoveryv1.AddressTypeIPv4,
+			endpoint("10.0.9.9", "zone-a", "node-1", true, true, false),
+		),
+	)
+	w := &EndpointSlicesWatcher{Namespace: "default", Service: "web", Client: client}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend)
+	go w.Watch(ctx, updates)
+
+	initial := receiveBackends(t, updates)
+	if len(initial) != 1 || initial[0].ID != "10.0.0.1" || initial[0].FailureDomain != "zone-a/node-1" {
+		t.Fatalf("initial backends = %+v, want 10.0.0.1 in zone-a/node-1", initial)
+	}
+
+	added := endpointSlice("web-2", "web", discoveryv1.AddressTypeIPv4,
+		endpoint("10.0.0.2", "zone-b", "node-2", true, true, false),
+	)
+	if _, err := client.DiscoveryV1().EndpointSlices("default").Create(ctx, added, metav1.CreateOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got := backendIDs(receiveBackends(t, updates)); !slices.Equal(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Fatalf("backends after create = %v", got)
+	}
+
+	if err := client.DiscoveryV1().EndpointSlices("default").Delete(ctx, "web-1", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := backendIDs(receiveBackends(t, updates)); !slices.Equal(got, []string{"10.0.0.2"}) {
+		t.Fatalf("backends after delete = %v", got)
+	}
+}
+
+func TestEndpointSlicesWatcherSendsEmptyInitialSet(t *testing.T) {
+	w := &EndpointSlicesWatcher{Namespace: "default", Service: "web", Client: fake.NewClientset()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend)
+	go w.Watch(ctx, updates)
+
+	if initial := receiveBackends(t, updates); len(initial) != 0 {
+		t.Fatalf("initial backends = %v, want none", initial)
+	}
+}
+
+func TestEndpointBackends(t *testing.T) {
+	tests := []struct {
+		name   string
+		slices []any
+		want   []string
+	}{
+		{
+			name: "ready only",
+			slices: []any{endpointSlice("s", "web", discoveryv1.AddressTypeIPv4,
+				endpoint("10.0.0.1", "a", "n1", true, true, false),
+				endpoint("10.0.0.2", "a", "n1", false, false, false),
+				endpoint("10.0.0.3", "a", "n1", false, true, true),
+			)},
+			want: []string{"10.0.0.1"},
+		},
+		{
+			name: "serving terminating fallback",
+			slices: []any{endpointSlice("s", "web", discoveryv1.AddressTypeIPv4,
+				endpoint("10.0.0.2", "a", "n1", false, false, true),
+				endpoint("10.0.0.3", "a", "n1", false, true, true),
+			)},
+			want: []string{"10.0.0.3"},
+		},
+		{
+			name: "duplicates across slices",
+			slices: []any{
+				endpointSlice("s1", "web", discoveryv1.AddressTypeIPv4, endpoint("10.0.0.1", "a", "n1", true, true, false)),
+				endpointSlice("s2", "web", discoveryv1.AddressTypeIPv4, endpoint("10.0.0.1", "a", "n1", true, true, false)),
+			},
+			want: []string{"10.0.0.1"},
+		},
+		{
+			name: "other services and families",
+			slices: []any{
+				endpointSlice("s1", "other", discoveryv1.AddressTypeIPv4, endpoint("10.0.0.1", "a", "n1", true, true, false)),
+				endpointSlice("s2", "web", discoveryv1.AddressTypeIPv6, endpoint("fd00::1", "a", "n1", true, true, false)),
+			},
+			want: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := backendIDs(endpointBackends(tt.slices, "web", discoveryv1.AddressTypeIPv4))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("endpointBackends = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
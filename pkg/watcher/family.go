@@ -0,0 +1,59 @@
+package watcher
+
+import (
+	"fmt"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+// IPFamily selects which address families a watcher sends. In a
+// dual-stack cluster every pod has one address per family, so sending
+// both makes each pod two backends.
+type IPFamily int
+
+const (
+	IPFamilyPreferIPv4 IPFamily = iota // IPv4 if any, else IPv6
+	IPFamilyPreferIPv6                 // IPv6 if any, else IPv4
+	IPFamilyIPv4                       // IPv4 only
+	IPFamilyIPv6                       // IPv6 only
+	IPFamilyAny                        // both families
+)
+
+var ipFamilyNames = map[string]IPFamily{
+	"prefer-ipv4": IPFamilyPreferIPv4,
+	"prefer-ipv6": IPFamilyPreferIPv6,
+	"ipv4":        IPFamilyIPv4,
+	"ipv6":        IPFamilyIPv6,
+	"any":         IPFamilyAny,
+}
+
+// ParseIPFamily parses "prefer-ipv4", "prefer-ipv6", "ipv4", "ipv6" or "any"
+func ParseIPFamily(s string) (IPFamily, error) {
+	f, ok := ipFamilyNames[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown IP family %q", s)
+	}
+	return f, nil
+}
+
+// choose returns the backends of the selected families
+func (f IPFamily) choose(v4, v6 []maglev.Backend) []maglev.Backend {
+	switch f {
+	case IPFamilyIPv4:
+		return v4
+	case IPFamilyIPv6:
+		return v6
+	case IPFamilyPreferIPv6:
+		if len(v6) > 0 {
+			return v6
+		}
+		return v4
+	case IPFamilyAny:
+		return append(v4, v6...)
+	default:
+		if len(v4) > 0 {
+			return v4
+		}
+		return v6
+	}
+}
@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	"github.com/hanapedia/maglseven/pkg/util"
+)
+
+// FileWatcher polls a file listing one backend per line as
+// "ID [failure-domain [weight]]". Blank lines and lines starting with
+// "#" are ignored; the failure domain defaults to the ID, the weight to 1.
+type FileWatcher struct {
+	Path     string
+	Interval time.Duration
+	OnError  func(error) // called on every failed read after the first; the last set is kept
+
+	mu    sync.Mutex
+	stats FileStats
+}
+
+// FileStats counts the reads of a FileWatcher
+type FileStats struct {
+	Reads       uint64
+	Failures    uint64 // unreadable or unparsable files
+	Updates     uint64 // backend sets sent
+	LastError   error
+	LastSuccess time.Time
+}
+
+// Stats returns a snapshot of the watcher's read counters
+func (w *FileWatcher) Stats() FileStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+func (w *FileWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	var lastHash string
+
+	readAndSend := func() error {
+		w.record(func(s *FileStats) { s.Reads++ })
+		backends, err := w.read()
+		if err != nil {
+			w.record(func(s *FileStats) {
+				s.Failures++
+				s.LastError = err
+			})
+			return err
+		}
+		w.record(func(s *FileStats) { s.LastSuccess = time.Now() })
+
+		newHash := util.HashBackends(backends)
+		if newHash == lastHash {
+			return nil // no change
+		}
+		lastHash = newHash
+
+		select {
+		case updates <- backends:
+			w.record(func(s *FileStats) { s.Updates++ })
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	if err := readAndSend(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := readAndSend(); err != nil && ctx.Err() == nil && w.OnError != nil {
+				w.OnError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// read reads and parses the file
+func (w *FileWatcher) read() ([]maglev.Backend, error) {
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		return nil, err
+	}
+	backends, err := parseBackends(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", w.Path, err)
+	}
+	return backends, nil
+}
+
+func (w *FileWatcher) record(fn func(*FileStats)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn(&w.stats)
+}
+
+func parseBackends(data []byte) ([]maglev.Backend, error) {
+	var backends []maglev.Backend
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: too many fields", line)
+		}
+
+		backend := maglev.Backend{ID: fields[0], FailureDomain: fields[0], Weight: 1}
+		if len(fields) > 1 {
+			backend.FailureDomain = fields[1]
+		}
+		if len(fields) > 2 {
+			weight, err := strconv.ParseUint(fields[2], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid weight %q", line, fields[2])
+			}
+			backend.Weight = uint32(weight)
+		}
+		backends = append(backends, backend)
+	}
+	return backends, scanner.Err()
+}
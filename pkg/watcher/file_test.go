@@ -0,0 +1,72 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+)
+
+func writeBackendsFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+}
+
+func TestFileWatcherKeepsLastSetOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backends")
+	writeBackendsFile(t, path, "# backends\n10.0.0.1 zone-a\n10.0.0.2 zone-b 2\n")
+
+	errs := make(chan error, 100)
+	w := &FileWatcher{Path: path, Interval: 10 * time.Millisecond, OnError: func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend, 10)
+	go w.Watch(ctx, updates)
+
+	want := []maglev.Backend{
+		{ID: "10.0.0.1", FailureDomain: "zone-a", Weight: 1},
+		{ID: "10.0.0.2", FailureDomain: "zone-b", Weight: 2},
+	}
+	if got := receiveBackends(t, updates); !slices.Equal(got, want) {
+		t.Fatalf("backends = %+v, want %+v", got, want)
+	}
+
+	writeBackendsFile(t, path, "10.0.0.1 zone-a not-a-weight\n")
+	select {
+	case <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnError was not called for an unparsable file")
+	}
+	assertNoUpdate(t, updates)
+	if stats := w.Stats(); stats.Failures == 0 || stats.LastError == nil || stats.Updates != 1 {
+		t.Fatalf("stats after a bad file = %+v", stats)
+	}
+
+	writeBackendsFile(t, path, "10.0.0.3\n")
+	if got := backendIDs(receiveBackends(t, updates)); !slices.Equal(got, []string{"10.0.0.3"}) {
+		t.Fatalf("backends after recovery = %v", got)
+	}
+}
+
+func TestFileWatcherFailsOnInitialRead(t *testing.T) {
+	w := &FileWatcher{Path: filepath.Join(t.TempDir(), "missing"), Interval: time.Hour}
+
+	if err := w.Watch(context.Background(), make(chan []maglev.Backend, 1)); err == nil {
+		t.Fatal("Watch succeeded for a missing file")
+	}
+	if stats := w.Stats(); stats.Reads != 1 || stats.Failures != 1 {
+		t.Fatalf("stats = %+v, want one failed read", stats)
+	}
+}
@@ -0,0 +1,137 @@
+package watcher
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	"github.com/hanapedia/maglseven/pkg/util"
+)
+
+// SRVWatcher resolves SRV records and sends one backend per target, with
+// "target:port" as its ID and Address and the target as its failure domain.
+// Targets of the lowest priority are weighted by their SRV weight (all
+// zero means equal); targets of higher priorities are standby (weight 0).
+type SRVWatcher struct {
+	Service  string // e.g., "http"; empty with Proto looks up Name directly
+	Proto    string // e.g., "tcp"
+	Name     string // e.g., "hello-headless.default.svc.cluster.local"
+	Interval time.Duration
+	Resolver *net.Resolver // nil uses net.DefaultResolver
+	Timeout  time.Duration // per-query timeout; 0 means none
+	OnError  func(error)   // called on every failed resolution after the first; the last set is kept
+
+	counters dnsCounters
+}
+
+// Stats returns a snapshot of the watcher's resolution counters
+func (w *SRVWatcher) Stats() DNSStats {
+	return w.counters.snapshot()
+}
+
+func (w *SRVWatcher) Watch(ctx context.Context, updates chan<- []maglev.Backend) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	resolver := w.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	var lastHash string
+
+	resolveAndSend := func() error {
+		lookupCtx := ctx
+		if w.Timeout > 0 {
+			var cancel context.CancelFunc
+			lookupCtx, cancel = context.WithTimeout(ctx, w.Timeout)
+			defer cancel()
+		}
+
+		w.counters.record(func(s *DNSStats) { s.Lookups++ })
+		_, records, err := resolver.LookupSRV(lookupCtx, w.Service, w.Proto, w.Name)
+		if err != nil {
+			w.counters.recordFailure(err)
+			return err
+		}
+		w.counters.record(func(s *DNSStats) { s.LastSuccess = time.Now() })
+
+		backends := srvBackends(records)
+		newHash := util.HashBackends(backends)
+		if newHash == lastHash {
+			return nil // no change
+		}
+		lastHash = newHash
+
+		select {
+		case updates <- backends:
+			w.counters.record(func(s *DNSStats) { s.Updates++ })
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	if err := resolveAndSend(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := resolveAndSend(); err != nil && ctx.Err() == nil && w.OnError != nil {
+				w.OnError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func srvBackends(records []*net.SRV) []maglev.Backend {
+	if len(records) == 0 {
+		return nil
+	}
+
+	// Only the lowest priority is active, weighted as in RFC 2782
+	active := records[0].Priority
+	allZero := true
+	for _, r := range records {
+		if r.Priority < active {
+			active = r.Priority
+			allZero = true
+		}
+		if r.Priority == active && r.Weight > 0 {
+			allZero = false
+		}
+	}
+
+	backends := make([]maglev.Backend, 0, len(records))
+	seen := make(map[string]struct{}, len(records))
+	for _, r := range records {
+		host := strings.TrimSuffix(r.Target, ".")
+		addr := net.JoinHostPort(host, strconv.Itoa(int(r.Port)))
+		if _, dup := seen[addr]; dup {
+			continue
+		}
+		seen[addr] = struct{}{}
+
+		var weight uint32
+		if r.Priority == active {
+			weight = uint32(r.Weight)
+			if allZero {
+				weight = 1
+			}
+		}
+		backends = append(backends, maglev.Backend{
+			ID:            addr,
+			FailureDomain: host,
+			Weight:        weight,
+			Address:       addr,
+		})
+	}
+	return backends
+}
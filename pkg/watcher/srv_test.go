@@ -0,0 +1,122 @@
+package watcher
+
+import (
+	"cmp"
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestSRVWatcher(t *testing.T) {
+	dns := newTestDNSServer(t)
+	dns.setSRVs("_http._tcp.web.test.",
+		net.SRV{Target: "a.web.test.", Port: 8080, Priority: 10, Weight: 60},
+		net.SRV{Target: "b.web.test.", Port: 8080, Priority: 10, Weight: 40},
+		net.SRV{Target: "c.web.test.", Port: 9090, Priority: 20, Weight: 100},
+	)
+
+	w := &SRVWatcher{
+		Service:  "http",
+		Proto:    "tcp",
+		Name:     "web.test.",
+		Interval: 10 * time.Millisecond,
+		Resolver: dns.resolver(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend)
+	go w.Watch(ctx, updates)
+
+	got := receiveBackends(t, updates)
+	slices.SortFunc(got, func(a, b maglev.Backend) int { return cmp.Compare(a.ID, b.ID) })
+	want := []maglev.Backend{
+		{ID: "a.web.test:8080", FailureDomain: "a.web.test", Weight: 60, Address: "a.web.test:8080"},
+		{ID: "b.web.test:8080", FailureDomain: "b.web.test", Weight: 40, Address: "b.web.test:8080"},
+		{ID: "c.web.test:9090", FailureDomain: "c.web.test", Weight: 0, Address: "c.web.test:9090"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("backends = %+v, want %+v", got, want)
+	}
+
+	// Records changing between lookups are picked up on the next tick
+	dns.setSRVs("_http._tcp.web.test.",
+		net.SRV{Target: "b.web.test.", Port: 8080, Priority: 10, Weight: 40},
+	)
+	if got := backendIDs(receiveBackends(t, updates)); !slices.Equal(got, []string{"b.web.test:8080"}) {
+		t.Fatalf("backends after update = %v", got)
+	}
+}
+
+func TestSRVWatcherKeepsLastSetOnFailure(t *testing.T) {
+	dns := newTestDNSServer(t)
+	dns.setSRVs("_http._tcp.web.test.",
+		net.SRV{Target: "a.web.test.", Port: 8080, Priority: 10, Weight: 1},
+	)
+
+	errs := make(chan error, 100)
+	w := &SRVWatcher{
+		Service:  "http",
+		Proto:    "tcp",
+		Name:     "web.test.",
+		Interval: 10 * time.Millisecond,
+		Resolver: dns.resolver(),
+		Timeout:  time.Second,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan []maglev.Backend, 10)
+	go w.Watch(ctx, updates)
+	receiveBackends(t, updates)
+
+	dns.setRCode(dnsmessage.RCodeServerFailure)
+	select {
+	case <-errs:
+	case <-time.After(10 * time.Second):
+		t.Fatal("OnError was not called on SERVFAIL")
+	}
+	assertNoUpdate(t, updates)
+	if stats := w.Stats(); stats.ServerFails == 0 || stats.LastError == nil || stats.Updates != 1 {
+		t.Fatalf("stats after SERVFAIL = %+v", stats)
+	}
+}
+
+func TestSRVWatcherFailsOnInitialLookup(t *testing.T) {
+	dns := newTestDNSServer(t)
+	w := &SRVWatcher{Name: "missing.test.", Interval: time.Hour, Resolver: dns.resolver()}
+
+	err := w.Watch(context.Background(), make(chan []maglev.Backend, 1))
+	if err == nil {
+		t.Fatal("Watch succeeded for a missing name")
+	}
+}
+
+func TestSRVBackends(t *testing.T) {
+	// All-zero weights of the active priority are weighted equally
+	got := srvBackends([]*net.SRV{
+		{Target: "b.test.", Port: 80, Priority: 1},
+		{Target: "a.test.", Port: 80, Priority: 1},
+		{Target: "a.test.", Port: 80, Priority: 1},
+		{Target: "z.test.", Port: 80, Priority: 2, Weight: 5},
+	})
+	want := []maglev.Backend{
+		{ID: "b.test:80", FailureDomain: "b.test", Weight: 1, Address: "b.test:80"},
+		{ID: "a.test:80", FailureDomain: "a.test", Weight: 1, Address: "a.test:80"},
+		{ID: "z.test:80", FailureDomain: "z.test", Weight: 0, Address: "z.test:80"},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("srvBackends = %+v, want %+v", got, want)
+	}
+}
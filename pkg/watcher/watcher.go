@@ -0,0 +1,231 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hanapedia/maglseven/pkg/maglev"
+	"github.com/hanapedia/maglseven/pkg/util"
+)
+
+// Watcher discovers backends and sends the full set on updates whenever
+// it changes, until ctx is done. The set may be empty, e.g., when a
+// Service has no endpoints left; consumers must handle that themselves,
+// as maglev.Build and balancer.New reject it.
+type Watcher interface {
+	Watch(ctx context.Context, updates chan<- []maglev.Backend) error
+}
+
+// Factory builds a Watcher from a parsed spec
+type Factory func(spec *url.URL) (Watcher, error)
+
+// DefaultInterval is the polling interval of polling watchers whose spec
+// does not set one
+const DefaultInterval = 10 * time.Second
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{
+		"dns":    newDNSWatcher,
+		"srv":    newSRVWatcher,
+		"k8s":    newEndpointSlicesWatcher,
+		"static": newStaticWatcher,
+		"file":   newFileWatcher,
+	}
+)
+
+// Register makes a Factory available to New under the given URI scheme,
+// replacing any previous one
+func Register(scheme string, f Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[scheme] = f
+}
+
+// New returns the watcher for a URI-like spec:
+//
+//	dns://hello-headless.default.svc.cluster.local?interval=10s&cidr=24&cidr6=64&family=prefer-ipv6
+//	dns://hello-headless.default.svc.cluster.local?server=10.96.0.10:53&protocol=tcp&timeout=2s&clear-on-nxdomain=true
+//	srv://_http._tcp.hello-headless.default.svc.cluster.local?interval=10s&timeout=2s
+//	k8s://default/hello-headless?resync=1m&family=ipv6
+//	static://10.0.0.1,10.0.0.2
+//	file:///etc/maglseven/backends?interval=10s
+func New(spec string) (Watcher, error) {
+	u, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	registryMu.RLock()
+	f, ok := registry[u.Scheme]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown watcher scheme %q", u.Scheme)
+	}
+	return f(u)
+}
+
+// parseSpec splits a spec into scheme, host, path and query. Unlike
+// url.Parse it accepts any host, e.g., a comma-separated list of backends.
+func parseSpec(spec string) (*url.URL, error) {
+	scheme, rest, ok := strings.Cut(spec, "://")
+	if !ok || scheme == "" {
+		return nil, fmt.Errorf("invalid watcher spec %q: missing scheme", spec)
+	}
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	host, path, _ := strings.Cut(rest, "/")
+	if _, err := url.ParseQuery(rawQuery); err != nil {
+		return nil, fmt.Errorf("invalid watcher spec %q: %w", spec, err)
+	}
+
+	u := &url.URL{Scheme: scheme, Host: host, RawQuery: rawQuery}
+	if path != "" {
+		u.Path = "/" + path
+	}
+	return u, nil
+}
+
+// family returns the spec's "family" query parameter, or IPFamilyPreferIPv4
+func family(spec *url.URL) (IPFamily, error) {
+	s := spec.Query().Get("family")
+	if s == "" {
+		return IPFamilyPreferIPv4, nil
+	}
+	return ParseIPFamily(s)
+}
+
+// interval returns the spec's "interval" query parameter, or DefaultInterval
+func interval(spec *url.URL) (time.Duration, error) {
+	s := spec.Query().Get("interval")
+	if s == "" {
+		return DefaultInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid interval %q", s)
+	}
+	return d, nil
+}
+
+func newDNSWatcher(spec *url.URL) (Watcher, error) {
+	if spec.Host == "" {
+		return nil, fmt.Errorf("dns watcher spec %q has no host", spec)
+	}
+	every, err := interval(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := family(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &DNSWatcher{FQDN: spec.Host, Interval: every, Family: f}
+	if cidr := spec.Query().Get("cidr"); cidr != "" {
+		mask, err := util.ParseCIDRMaskFromString(cidr)
+		if err != nil {
+			return nil, err
+		}
+		w.FailureCIDR = &mask
+	}
+	if cidr := spec.Query().Get("cidr6"); cidr != "" {
+		mask, err := util.ParseCIDRMask6FromString(cidr)
+		if err != nil {
+			return nil, err
+		}
+		w.FailureCIDR6 = &mask
+	}
+
+	query := spec.Query()
+	w.Server = query.Get("server")
+	w.Protocol = query.Get("protocol")
+	if w.Protocol != "" && w.Protocol != "udp" && w.Protocol != "tcp" {
+		return nil, fmt.Errorf("invalid protocol %q", w.Protocol)
+	}
+	if s := query.Get("timeout"); s != "" {
+		timeout, err := time.ParseDuration(s)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout %q", s)
+		}
+		w.Timeout = timeout
+	}
+	if s := query.Get("clear-on-nxdomain"); s != "" {
+		clear, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clear-on-nxdomain %q", s)
+		}
+		w.ClearOnNotFound = clear
+	}
+	return w, nil
+}
+
+func newSRVWatcher(spec *url.URL) (Watcher, error) {
+	if spec.Host == "" {
+		return nil, fmt.Errorf("srv watcher spec %q has no host", spec)
+	}
+	every, err := interval(spec)
+	if err != nil {
+		return nil, err
+	}
+	w := &SRVWatcher{Name: spec.Host, Interval: every}
+	if s := spec.Query().Get("timeout"); s != "" {
+		timeout, err := time.ParseDuration(s)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid timeout %q", s)
+		}
+		w.Timeout = timeout
+	}
+	return w, nil
+}
+
+func newEndpointSlicesWatcher(spec *url.URL) (Watcher, error) {
+	service := strings.Trim(spec.Path, "/")
+	if spec.Host == "" || service == "" || strings.Contains(service, "/") {
+		return nil, fmt.Errorf("k8s watcher spec %q is not k8s://namespace/service", spec)
+	}
+
+	f, err := family(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &EndpointSlicesWatcher{Namespace: spec.Host, Service: service, Family: f}
+	if s := spec.Query().Get("resync"); s != "" {
+		resync, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resync %q", s)
+		}
+		w.Resync = resync
+	}
+	return w, nil
+}
+
+func newStaticWatcher(spec *url.URL) (Watcher, error) {
+	var backends []maglev.Backend
+	for id := range strings.SplitSeq(spec.Host, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			backends = append(backends, maglev.Backend{ID: id, FailureDomain: id, Weight: 1})
+		}
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("static watcher spec %q has no backends", spec)
+	}
+	return &StaticWatcher{Backends: backends}, nil
+}
+
+func newFileWatcher(spec *url.URL) (Watcher, error) {
+	if spec.Path == "" {
+		return nil, fmt.Errorf("file watcher spec %q has no path", spec)
+	}
+	every, err := interval(spec)
+	if err != nil {
+		return nil, err
+	}
+	return &FileWatcher{Path: spec.Path, Interval: every}, nil
+}